@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+
+	"poolcensus/desktop/stratum"
+)
+
+const (
+	authorizeAccepted = "accepted"
+	authorizeRejected = "rejected"
+	authorizeUnknown  = "unknown"
+)
+
+// addressCheck records how a pool treated a wallet of one address type.
+type addressCheck struct {
+	AddressType string
+	Wallet      string
+	Authorize   string
+	HasCoinbase bool
+	PaysScript  bool
+	Error       string
+}
+
+// probeAddressTypes authorizes with a fresh wallet of every address type at
+// each aggregate's endpoint and checks the coinbase pays that wallet's script.
+func probeAddressTypes(aggregates []*scanAggregate, agent, worker string) error {
+	if len(aggregates) == 0 {
+		return nil
+	}
+	r := newStream(streamAddressTypes)
+	wallets := make(map[string]string, len(walletAddressTypes))
+	for _, addressType := range walletAddressTypes {
+		wallet, err := generateWallet(r, addressType)
+		if err != nil {
+			return err
+		}
+		wallets[addressType] = wallet
+	}
+
+	total := len(aggregates) * len(walletAddressTypes)
+	progress := 0
+	fmt.Println("Probing address types")
+	printProgress(progress, total)
+	for _, agg := range aggregates {
+		for _, addressType := range walletAddressTypes {
+			wallet := walletOnNetwork(wallets[addressType], networkParams(agg.target.Network))
+			entry, err := collectFromPool(agg.target, agent, wallet+"."+worker, wallet, worker)
+			progress++
+			printProgress(progress, total)
+			agg.addressChecks = append(agg.addressChecks, checkAddressType(addressType, wallet, entry, err))
+			if err != nil && verbose {
+				log.Printf("pool %s:%d with %s wallet: %v", agg.target.Host, agg.target.Port, addressType, err)
+			}
+		}
+	}
+	return nil
+}
+
+func checkAddressType(addressType, wallet string, entry *logEntry, err error) addressCheck {
+	check := addressCheck{AddressType: addressType, Wallet: wallet, Authorize: authorizeOutcome(entry, err)}
+	if err != nil {
+		check.Error = err.Error()
+	}
+	if entry == nil || entry.CoinbaseRaw == nil || len(entry.Payouts) == 0 {
+		return check
+	}
+	check.HasCoinbase = true
+	check.PaysScript = paysAddress(entry.Payouts, wallet, networkParams(entry.Network))
+	return check
+}
+
+// authorizeOutcome classifies a probe session by whether mining.authorize
+// succeeded. Failures before authorization are unknown.
+func authorizeOutcome(entry *logEntry, err error) string {
+	if err == nil {
+		return authorizeAccepted
+	}
+	var rpcErr *stratum.RPCError
+	switch {
+	case errors.Is(err, stratum.ErrAuthorizationRejected),
+		errors.As(err, &rpcErr) && rpcErr.Method == "mining.authorize":
+		return authorizeRejected
+	case entry == nil || !entry.Connected:
+		return authorizeUnknown
+	}
+	return authorizeAccepted
+}
+
+// paysAddress reports whether any payout's scriptPubKey is exactly the one
+// wallet decodes to.
+func paysAddress(payouts []payout, wallet string, params *chaincfg.Params) bool {
+	want := addressScript(wallet, params)
+	if want == nil {
+		return false
+	}
+	for _, p := range payouts {
+		if paysScript(p, wallet, want) {
+			return true
+		}
+	}
+	return false
+}
+
+// addressScript decodes an address to its scriptPubKey, or nil if it is not a
+// valid address on params. DecodeAddress alone accepts some other networks'
+// encodings, so the network is checked explicitly.
+func addressScript(wallet string, params *chaincfg.Params) []byte {
+	addr, err := btcutil.DecodeAddress(wallet, params)
+	if err != nil || !addr.IsForNet(params) {
+		return nil
+	}
+	script, err := txscript.PayToAddrScript(addr)
+	if err != nil {
+		return nil
+	}
+	return script
+}
+
+// paysScript reports whether p pays the wallet whose scriptPubKey is script.
+// Scripts are compared byte for byte so encoding differences (bech32 case,
+// address versions) cannot hide a match; payouts recorded without a script
+// fall back to comparing addresses.
+func paysScript(p payout, wallet string, script []byte) bool {
+	if script != nil && p.Script != "" {
+		raw, err := hex.DecodeString(p.Script)
+		return err == nil && bytes.Equal(raw, script)
+	}
+	return p.Address != "" && wallet != "" && p.Address == wallet
+}
+
+// summarizeAddressChecks flags address types the pool accepts but does not pay
+// while it does pay other types directly; pools that never pay the worker in
+// the coinbase are already covered by the payout issues.
+func summarizeAddressChecks(checks []addressCheck) (unpaid []string) {
+	paysAny := false
+	for _, c := range checks {
+		if c.PaysScript {
+			paysAny = true
+		}
+	}
+	if !paysAny {
+		return nil
+	}
+	for _, c := range checks {
+		if c.Authorize == authorizeAccepted && c.HasCoinbase && !c.PaysScript {
+			unpaid = append(unpaid, c.AddressType)
+		}
+	}
+	return unpaid
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+	"strconv"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcutil"
+)
+
+// Amounts are int64 satoshis from wire.TxOut.Value onwards; they only become
+// BTC strings when rendered, so totals, fees and shares are exact.
+
+// percentage is a share in hundredths of a percent, rounded down so that a
+// share just short of a threshold never displays as reaching it.
+type percentage int64
+
+// String renders p like "97.5%".
+func (p percentage) String() string {
+	sign := ""
+	if p < 0 {
+		sign, p = "-", -p
+	}
+	s := fmt.Sprintf("%d.%02d", p/100, p%100)
+	s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	return sign + s + "%"
+}
+
+// share is part's share of total. Amounts are expected to be non-negative;
+// the product is taken in 128 bits so no pool-supplied value can overflow it.
+func share(part, total int64) percentage {
+	if part <= 0 || total <= 0 {
+		return 0
+	}
+	hi, lo := bits.Mul64(uint64(part), 10000)
+	if hi >= uint64(total) {
+		return math.MaxInt64
+	}
+	q, _ := bits.Div64(hi, lo, uint64(total))
+	if q > math.MaxInt64 {
+		return math.MaxInt64
+	}
+	return percentage(q)
+}
+
+// belowShare reports whether part is less than p of whole, exactly.
+func belowShare(part, whole int64, p percentage) bool {
+	switch {
+	case whole <= 0 || p <= 0:
+		return false
+	case part < 0:
+		return true
+	}
+	lhsHi, lhsLo := bits.Mul64(uint64(part), 10000)
+	rhsHi, rhsLo := bits.Mul64(uint64(whole), uint64(p))
+	return lhsHi < rhsHi || (lhsHi == rhsHi && lhsLo < rhsLo)
+}
+
+// addSats adds b to a, saturating instead of wrapping; coinbase values
+// outside the money range are flagged by the lint but still summed.
+func addSats(a, b int64) int64 {
+	switch {
+	case b > 0 && a > math.MaxInt64-b:
+		return math.MaxInt64
+	case b < 0 && a < math.MinInt64-b:
+		return math.MinInt64
+	}
+	return a + b
+}
+
+// formatBTC renders sats as BTC with trailing zeros trimmed, without going
+// through floating point.
+func formatBTC(sats int64) string {
+	sign := ""
+	u := uint64(sats)
+	if sats < 0 {
+		sign, u = "-", -u
+	}
+	whole, frac := u/btcutil.SatoshiPerBitcoin, u%btcutil.SatoshiPerBitcoin
+	if frac == 0 {
+		return sign + strconv.FormatUint(whole, 10)
+	}
+	return sign + strings.TrimRight(fmt.Sprintf("%d.%08d", whole, frac), "0")
+}
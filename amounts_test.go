@@ -0,0 +1,112 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestShare(t *testing.T) {
+	tests := []struct {
+		part, total int64
+		want        percentage
+		str         string
+	}{
+		{98, 100, minWorkerShare, "98%"},
+		// Just short of 98% rounds down rather than up to it.
+		{97_999_999, 100_000_000, 9799, "97.99%"},
+		{98_000_001, 100_000_000, 9800, "98%"},
+		{1, 3, 3333, "33.33%"},
+		{312500000, 312500000, 10000, "100%"},
+		{0, 100, 0, "0%"},
+		{100, 0, 0, "0%"},
+		{-5, 100, 0, "0%"},
+		{math.MaxInt64, math.MaxInt64, 10000, "100%"},
+		{math.MaxInt64, 1, math.MaxInt64, ""},
+	}
+	for _, tt := range tests {
+		got := share(tt.part, tt.total)
+		if got != tt.want {
+			t.Errorf("share(%d, %d) = %d, want %d", tt.part, tt.total, got, tt.want)
+		}
+		if tt.str != "" && got.String() != tt.str {
+			t.Errorf("share(%d, %d) renders %q, want %q", tt.part, tt.total, got, tt.str)
+		}
+	}
+}
+
+func TestBelowShare(t *testing.T) {
+	tests := []struct {
+		part, whole int64
+		p           percentage
+		want        bool
+	}{
+		// Exactly 98% is not below it; one satoshi less is.
+		{306_250_000, 312_500_000, minWorkerShare, false},
+		{306_249_999, 312_500_000, minWorkerShare, true},
+		{306_250_001, 312_500_000, minWorkerShare, false},
+		{0, 312_500_000, minWorkerShare, true},
+		{-1, 312_500_000, minWorkerShare, true},
+		{0, 0, minWorkerShare, false},
+		{1, 100, 0, false},
+		{math.MaxInt64 - 1, math.MaxInt64, 10000, true},
+		{math.MaxInt64, math.MaxInt64, 10000, false},
+	}
+	for _, tt := range tests {
+		if got := belowShare(tt.part, tt.whole, tt.p); got != tt.want {
+			t.Errorf("belowShare(%d, %d, %s) = %v, want %v", tt.part, tt.whole, tt.p, got, tt.want)
+		}
+	}
+}
+
+func TestPercentageString(t *testing.T) {
+	tests := map[percentage]string{
+		0:     "0%",
+		5:     "0.05%",
+		50:    "0.5%",
+		9750:  "97.5%",
+		10000: "100%",
+		-250:  "-2.5%",
+	}
+	for p, want := range tests {
+		if got := p.String(); got != want {
+			t.Errorf("percentage(%d) = %q, want %q", int64(p), got, want)
+		}
+	}
+}
+
+func TestFormatBTC(t *testing.T) {
+	tests := []struct {
+		sats int64
+		want string
+	}{
+		{0, "0"},
+		{1, "0.00000001"},
+		{100_000_000, "1"},
+		{312_500_000, "3.125"},
+		{2_100_000_000_000_000, "21000000"},
+		{-50_000_000, "-0.5"},
+		{math.MaxInt64, "92233720368.54775807"},
+		{math.MinInt64, "-92233720368.54775808"},
+	}
+	for _, tt := range tests {
+		if got := formatBTC(tt.sats); got != tt.want {
+			t.Errorf("formatBTC(%d) = %q, want %q", tt.sats, got, tt.want)
+		}
+	}
+}
+
+func TestAddSats(t *testing.T) {
+	tests := []struct {
+		a, b, want int64
+	}{
+		{1, 2, 3},
+		{math.MaxInt64, 1, math.MaxInt64},
+		{math.MinInt64, -1, math.MinInt64},
+		{math.MaxInt64, -1, math.MaxInt64 - 1},
+	}
+	for _, tt := range tests {
+		if got := addSats(tt.a, tt.b); got != tt.want {
+			t.Errorf("addSats(%d, %d) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
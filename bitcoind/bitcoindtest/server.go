@@ -0,0 +1,105 @@
+// Package bitcoindtest provides an in-process stand-in for a Bitcoin Core
+// JSON-RPC endpoint, serving a fixed chain state for census tests.
+package bitcoindtest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+
+	"poolcensus/desktop/bitcoind"
+)
+
+// Node is the chain state the server reports.
+type Node struct {
+	Chain         string
+	BestBlockHash string
+	Template      bitcoind.BlockTemplate
+
+	// User and Password, when set, are required as basic auth.
+	User     string
+	Password string
+}
+
+// Server answers getblockchaininfo, getbestblockhash and getblocktemplate.
+type Server struct {
+	srv *httptest.Server
+
+	mu    sync.Mutex
+	node  Node
+	calls []string
+}
+
+func NewServer(node Node) *Server {
+	s := &Server{node: node}
+	s.srv = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// URL is the endpoint to hand to bitcoind.NewClient.
+func (s *Server) URL() string {
+	return s.srv.URL
+}
+
+// SetNode replaces the chain state, e.g. to simulate a new block.
+func (s *Server) SetNode(node Node) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.node = node
+}
+
+// Calls returns every method called so far.
+func (s *Server) Calls() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.calls...)
+}
+
+func (s *Server) Close() {
+	s.srv.Close()
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	node := s.node
+	s.mu.Unlock()
+
+	if node.User != "" || node.Password != "" {
+		user, pass, ok := r.BasicAuth()
+		if !ok || user != node.User || pass != node.Password {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+	}
+	var req struct {
+		ID     json.RawMessage `json:"id"`
+		Method string          `json:"method"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	s.mu.Lock()
+	s.calls = append(s.calls, req.Method)
+	s.mu.Unlock()
+
+	var result any
+	switch req.Method {
+	case "getblockchaininfo":
+		result = bitcoind.BlockchainInfo{Chain: node.Chain, Blocks: node.Template.Height - 1, BestBlockHash: node.BestBlockHash}
+	case "getbestblockhash":
+		result = node.BestBlockHash
+	case "getblocktemplate":
+		result = node.Template
+	default:
+		w.WriteHeader(http.StatusInternalServerError)
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"id":     req.ID,
+			"result": nil,
+			"error":  map[string]any{"code": -32601, "message": "Method not found"},
+		})
+		return
+	}
+	_ = json.NewEncoder(w).Encode(map[string]any{"id": req.ID, "result": result, "error": nil})
+}
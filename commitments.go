@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/hex"
+	"slices"
+	"sort"
+	"strings"
+
+	"poolcensus/desktop/stratum"
+)
+
+// commitmentNames are the display names of stratum's commitment protocols.
+var commitmentNames = map[string]string{
+	stratum.CommitmentWitness: "SegWit witness commitment",
+	stratum.CommitmentRSK:     "RSK (Rootstock)",
+	stratum.CommitmentAuxPoW:  "AuxPoW (Namecoin, Syscoin, Elastos, ...)",
+	stratum.CommitmentCoreDAO: "Core DAO",
+	stratum.CommitmentHathor:  "Hathor",
+	stratum.CommitmentStacks:  "Stacks",
+	stratum.CommitmentOmni:    "Omni Layer",
+	stratum.CommitmentUnknown: "Unknown",
+}
+
+// mergedMiningProtocols earn the pool a reward on another chain for the same
+// work; the rest only record data.
+var mergedMiningProtocols = map[string]bool{
+	stratum.CommitmentRSK:     true,
+	stratum.CommitmentAuxPoW:  true,
+	stratum.CommitmentCoreDAO: true,
+	stratum.CommitmentHathor:  true,
+}
+
+func buildCommitments(info *stratum.CoinbaseInfo) []commitmentData {
+	if info == nil {
+		return nil
+	}
+	var out []commitmentData
+	for _, c := range info.Commitments {
+		name := commitmentNames[c.Protocol]
+		if name == "" {
+			name = c.Protocol
+		}
+		out = append(out, commitmentData{
+			Protocol:     c.Protocol,
+			Name:         name,
+			Source:       c.Source,
+			OutputIndex:  c.OutputIndex,
+			Hex:          hex.EncodeToString(c.Data),
+			Payload:      hex.EncodeToString(c.Payload),
+			Text:         asciiPreview(c.Data),
+			MergedMining: mergedMiningProtocols[c.Protocol],
+		})
+	}
+	return out
+}
+
+// mergedMiningNames lists the merged-mining protocols an entry commits to,
+// each once.
+func mergedMiningNames(commitments []commitmentData) []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, c := range commitments {
+		if c.MergedMining && !seen[c.Protocol] {
+			seen[c.Protocol] = true
+			names = append(names, c.Name)
+		}
+	}
+	return names
+}
+
+// summarizeMergedMining groups pools by the merged-mining protocols their
+// coinbases commit to.
+func summarizeMergedMining(views []*entryView) []mergedMiningRow {
+	pools := make(map[string][]string)
+	for _, v := range views {
+		for _, name := range v.MergedMining {
+			pools[name] = append(pools[name], firstNonEmpty(v.PoolName, v.Host))
+		}
+	}
+	rows := make([]mergedMiningRow, 0, len(pools))
+	for name, list := range pools {
+		sort.Strings(list)
+		rows = append(rows, mergedMiningRow{Protocol: name, Pools: slices.Compact(list)})
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].Protocol < rows[j].Protocol })
+	return rows
+}
+
+// asciiPreview renders b as text with non-printable bytes shown as dots, so
+// tags inside binary payloads stay readable.
+func asciiPreview(b []byte) string {
+	var sb strings.Builder
+	for _, c := range b {
+		if c < 0x20 || c > 0x7e {
+			sb.WriteByte('.')
+			continue
+		}
+		sb.WriteByte(c)
+	}
+	return sb.String()
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"sort"
+
+	"poolcensus/desktop/stratum"
+)
+
+// deviationPenalty is charged once per distinct deviation kind seen across all
+// sessions with a pool, so repeated scans do not compound the same fault.
+var deviationPenalty = map[string]int{
+	stratum.DeviationInvalidJSON:        25,
+	stratum.DeviationMalformedNotify:    25,
+	stratum.DeviationBadExtraNonce2:     40,
+	stratum.DeviationZeroExtraNonce2:    25,
+	stratum.DeviationMalformedParams:    15,
+	stratum.DeviationUnexpectedResponse: 10,
+	stratum.DeviationUnknownMethod:      5,
+}
+
+const defaultDeviationPenalty = 10
+
+func summarizeConformance(deviations []protocolDeviation) conformanceSummary {
+	seen := make(map[string]bool)
+	score := 100
+	for _, dev := range deviations {
+		if seen[dev.Kind] {
+			continue
+		}
+		seen[dev.Kind] = true
+		penalty, ok := deviationPenalty[dev.Kind]
+		if !ok {
+			penalty = defaultDeviationPenalty
+		}
+		score -= penalty
+	}
+	if score < 0 {
+		score = 0
+	}
+
+	kinds := make([]string, 0, len(seen))
+	for kind := range seen {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+
+	return conformanceSummary{
+		Score:      score,
+		Class:      conformanceClass(score),
+		Deviations: len(deviations),
+		Kinds:      kinds,
+	}
+}
+
+func conformanceClass(score int) string {
+	switch {
+	case score >= 90:
+		return "reward-blue"
+	case score >= 60:
+		return ""
+	default:
+		return "reward-red"
+	}
+}
@@ -2,11 +2,10 @@ package main
 
 import (
 	"math"
-	"math/rand"
 	"sort"
 )
 
-func buildDashboardView(aggregates []*scanAggregate, sortBy string, baseReward float64) *dashboardView {
+func buildDashboardView(aggregates []*scanAggregate, sortBy string) *dashboardView {
 	clean := make([]*hostEntry, 0, len(aggregates))
 	issues := make([]*hostEntry, 0, len(aggregates))
 
@@ -25,21 +24,29 @@ func buildDashboardView(aggregates []*scanAggregate, sortBy string, baseReward f
 			}
 		}
 
-		view := buildEntryView(entry, baseReward, pingStats{}, agg.pingStats, agg.jobStats, nil, 0, plainPort, tlsPort)
+		view := buildEntryView(entry, pingStats{}, agg.pingStats, agg.jobStats, nil, 0, plainPort, tlsPort)
 		view.Host = entry.Host
 		view.PoolName = entry.PoolTag
 		if view.PoolName == "" {
 			view.PoolName = entry.Host
 		}
 		view.LogFile = ""
-		view.ScanURL = "#"
+		view.ScanURL = detailsURL(entry.Host, entry.Port)
 		view.HistoryURL = "#"
+		view.Conformance = summarizeConformance(agg.deviations)
+		addProfileIssue(view, compareProfiles(agg.profiles))
+		addAddressTypeIssues(view, agg.addressChecks)
+		addSafetyIssue(view, agg.safetyChecks)
+		addFeeRankIssue(view, agg.feeRank)
+		addTipIssues(view, agg.tipCheck)
+		addNodeIssues(view, agg.nodeCheck)
 
 		entryView := &hostEntry{
 			PoolName: view.PoolName,
 			Host: &hostView{
 				Host:   entry.Host,
 				Latest: view,
+				Raw:    publishedEntry(entry),
 			},
 			LogFile: "",
 		}
@@ -59,11 +66,18 @@ func buildDashboardView(aggregates []*scanAggregate, sortBy string, baseReward f
 		sortEntries(issues, sortBy)
 	}
 
+	views := make([]*entryView, 0, len(clean)+len(issues))
+	for _, e := range append(append([]*hostEntry(nil), clean...), issues...) {
+		views = append(views, e.Host.Latest)
+	}
+
 	return &dashboardView{
 		CleanEntries: clean,
 		IssueEntries: issues,
 		SortBy:       sortBy,
 		HostFilter:   "",
+		Signalling:   summarizeSignalling(views),
+		MergedMining: summarizeMergedMining(views),
 	}
 }
 
@@ -77,7 +91,7 @@ func shuffleEntries(entries []*hostEntry) {
 	if len(entries) < 2 {
 		return
 	}
-	rand.Shuffle(len(entries), func(i, j int) {
+	newStream(streamShuffle).Shuffle(len(entries), func(i, j int) {
 		entries[i], entries[j] = entries[j], entries[i]
 	})
 }
@@ -0,0 +1,103 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// deploymentBuried marks a deployment whose activation height is hard-coded;
+// its bit no longer signals anything, so setting it is stale.
+const deploymentBuried = "buried"
+
+type DeploymentsData struct {
+	Deployments []Deployment `json:"deployments"`
+}
+
+// Deployment is a soft fork miners signal for by setting Bit in the block
+// version while the top bits read 001 (BIP9).
+type Deployment struct {
+	Name        string `json:"name"`
+	Bit         int    `json:"bit"`
+	Status      string `json:"status,omitempty"`
+	Description string `json:"description,omitempty"`
+	// Networks limits the deployment to these chains; empty means all.
+	Networks []string `json:"networks,omitempty"`
+}
+
+//go:embed deployments.json
+var embeddedDeployments []byte
+
+// deployments is the list signals are matched against; main replaces it with
+// a deployments.json found next to the app.
+var deployments = mustParseDeployments(embeddedDeployments)
+
+// Buried reports whether the deployment activated and was buried, leaving its
+// bit free.
+func (d Deployment) Buried() bool {
+	return d.Status == deploymentBuried
+}
+
+func loadDeployments(path string) ([]Deployment, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseDeployments(data)
+}
+
+func parseDeployments(data []byte) ([]Deployment, error) {
+	var parsed DeploymentsData
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		return nil, fmt.Errorf("failed to parse deployments.json: %w", err)
+	}
+	for i := range parsed.Deployments {
+		d := &parsed.Deployments[i]
+		if strings.TrimSpace(d.Name) == "" {
+			return nil, fmt.Errorf("deployment %d has no name", i)
+		}
+		if d.Bit < 0 || d.Bit > 28 {
+			return nil, fmt.Errorf("deployment %s: bit %d is outside BIP9's 0-28", d.Name, d.Bit)
+		}
+		for j, name := range d.Networks {
+			network, err := normalizeNetwork(name)
+			if err != nil {
+				return nil, fmt.Errorf("deployment %s: %w", d.Name, err)
+			}
+			d.Networks[j] = network
+		}
+	}
+	sort.SliceStable(parsed.Deployments, func(i, j int) bool {
+		return parsed.Deployments[i].Bit < parsed.Deployments[j].Bit
+	})
+	return parsed.Deployments, nil
+}
+
+func mustParseDeployments(data []byte) []Deployment {
+	parsed, err := parseDeployments(data)
+	if err != nil {
+		panic(err)
+	}
+	return parsed
+}
+
+// deploymentForBit returns the deployment using bit on network, if any.
+func deploymentForBit(bit int, network string) (Deployment, bool) {
+	for _, d := range deployments {
+		if d.Bit != bit {
+			continue
+		}
+		if len(d.Networks) == 0 {
+			return d, true
+		}
+		for _, n := range d.Networks {
+			if n == network {
+				return d, true
+			}
+		}
+	}
+	return Deployment{}, false
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const detailsDir = "details"
+
+func detailsFileName(host string, port int) string {
+	clean := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-':
+			return r
+		default:
+			return '_'
+		}
+	}, host)
+	return fmt.Sprintf("%s-%d.html", clean, port)
+}
+
+func detailsURL(host string, port int) string {
+	return detailsDir + "/" + detailsFileName(host, port)
+}
+
+func buildDetailsView(entry *hostEntry, backURL string) *detailsView {
+	latest := entry.Host.Latest
+	raw := entry.Host.Raw
+	view := &detailsView{
+		PoolName:   entry.PoolName,
+		Host:       latest.Host,
+		Timestamp:  latest.Timestamp,
+		BackURL:    backURL,
+		HistoryURL: latest.HistoryURL,
+		JobLatency: latest.JobLatency,
+		Entry:      latest,
+		Raw:        raw,
+	}
+	if !latest.TimestampRaw.IsZero() {
+		view.TimestampLocal = latest.TimestampRaw.Local().Format(time.RFC3339)
+	}
+	return view
+}
+
+func writeDetailsPages(view *dashboardView, reportPath string) error {
+	dir := filepath.Join(filepath.Dir(reportPath), detailsDir)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create details directory: %w", err)
+	}
+	backURL := "../" + filepath.Base(reportPath)
+
+	entries := append(append([]*hostEntry(nil), view.CleanEntries...), view.IssueEntries...)
+	for _, entry := range entries {
+		if entry.Host == nil || entry.Host.Latest == nil || entry.Host.Raw == nil {
+			continue
+		}
+		path := filepath.Join(dir, detailsFileName(entry.Host.Raw.Host, entry.Host.Raw.Port))
+		if err := writeDetailsPage(path, buildDetailsView(entry, backURL)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeDetailsPage(path string, view *detailsView) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create details file: %w", err)
+	}
+	defer f.Close()
+	if err := tmpl.ExecuteTemplate(f, "details.tmpl", view); err != nil {
+		return fmt.Errorf("failed to render details template: %w", err)
+	}
+	return nil
+}
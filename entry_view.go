@@ -3,9 +3,10 @@ package main
 import (
 	"fmt"
 	"math"
-	"net/url"
 	"strings"
 	"time"
+
+	"poolcensus/desktop/stratum"
 )
 
 const (
@@ -13,9 +14,35 @@ const (
 	severitySingleMissingWallet = 80
 	severityNoPayout            = 120
 	severityLowShare            = 50
+	severityHostile             = 150
+	severityDiscrimination      = 110
+	severityUnpaidAddressType   = 100
+	severityRejectedAddressType = 40
+	severityAcceptsGarbage      = 130
+	severityLowFees             = 60
+	severityFeeOutlier          = 70
+	severityStaleTip            = 140
+	severityWrongBits           = 120
+	severityBadNTime            = 90
+	severityUnmineable          = 130
+	severityBadVersion          = 60
+	severityRollingBits         = 30
+	severityLintWarning         = 50
+	severityUnspendable         = 100
+	severityUnusualOutput       = 40
+)
+
+const (
+	// lowFeeShare is the share of the subsidy below which a mainnet
+	// template's fees count as unusually low; real mempools rarely leave
+	// blocks this empty.
+	lowFeeShare percentage = 20
+	// minWorkerShare is the least a worker should be paid of a coinbase that
+	// pays them at all.
+	minWorkerShare percentage = 9800
 )
 
-func buildEntryView(entry *logEntry, baseReward float64, tlsPing, plainPing, jobLatency pingStats, changes []changeDetail, hiddenChanges int, plainPort, tlsPort int) *entryView {
+func buildEntryView(entry *logEntry, tlsPing, plainPing, jobLatency pingStats, changes []changeDetail, hiddenChanges int, plainPort, tlsPort int) *entryView {
 	poolWallet, ok := dominantPoolWallet(entry)
 	tlsSummary := summarizePing(tlsPing)
 	plainSummary := summarizePing(plainPing)
@@ -49,9 +76,11 @@ func buildEntryView(entry *logEntry, baseReward float64, tlsPing, plainPing, job
 		HiddenChanges:      hiddenChanges,
 		PoolWallet:         poolWallet,
 		PoolWalletDisp:     walletDisplay(poolWallet),
-		PoolWalletURL:      blockchainAddressURL(poolWallet),
+		PoolWalletURL:      explorerAddressURL(entry.Network, poolWallet),
 		HasPoolWallet:      ok,
 		TLS:                entry.TLS,
+		Protocol:           entry.Protocol,
+		Network:            entry.Network,
 		PingSummaryPrimary: primarySummary,
 		PingSummaryTLS:     tlsSummary,
 		ShowTLSPanel:       showTLSPanel,
@@ -70,31 +99,36 @@ func buildEntryView(entry *logEntry, baseReward float64, tlsPing, plainPing, job
 		}
 	}
 
-	workerShare := 0.0
+	workerScript := addressScript(entry.WalletAddress, networkParams(entry.Network))
+	var workerShare int64
 	for _, payout := range entry.Payouts {
-		if payout.Address != "" && entry.WalletAddress != "" && payout.Address == entry.WalletAddress {
-			workerShare += payout.Amount
+		if paysScript(payout, entry.WalletAddress, workerScript) {
+			workerShare = addSats(workerShare, payout.Amount)
 		}
 	}
 	view.WorkerShare = workerShare
-	if entry.TotalPayout > 0 {
-		view.WorkerPercent = (workerShare / entry.TotalPayout) * 100
-	}
+	view.WorkerPercent = share(workerShare, entry.TotalPayout)
 
 	for _, payout := range entry.Payouts {
-		percent := 0.0
-		if entry.TotalPayout > 0 {
-			percent = (payout.Amount / entry.TotalPayout) * 100
-		}
 		view.DisplayPayouts = append(view.DisplayPayouts, payoutView{
 			payout:   payout,
-			IsWorker: payout.Address != "" && entry.WalletAddress != "" && payout.Address == entry.WalletAddress,
-			Percent:  percent,
+			IsWorker: paysScript(payout, entry.WalletAddress, workerScript),
+			Percent:  share(payout.Amount, entry.TotalPayout),
 		})
 	}
 
-	view.Issues, view.IssueSeverity = collectIssues(entry, workerShare, view.WorkerPercent)
-	view.RewardNote, view.RewardClass = rewardNoteAndClass(entry.TotalPayout, baseReward)
+	view.Issues, view.IssueSeverity = collectIssues(entry, workerShare)
+	if entry.BlockHeight > 0 {
+		view.HasSubsidy = true
+		view.Subsidy = blockSubsidy(networkParams(entry.Network), entry.BlockHeight)
+		view.Fees = entry.TotalPayout - view.Subsidy
+	}
+	view.RewardNote, view.RewardClass = rewardNoteAndClass(entry.TotalPayout, view.Subsidy, view.HasSubsidy)
+	addLowFeeIssue(view, entry)
+	view.MergedMining = mergedMiningNames(entry.Commitments)
+	if entry.Header != nil {
+		view.Signals = decodeVersionSignals(entry.Header.Version, firstNonEmpty(entry.Network, networkMainnet))
+	}
 	view.PanelClass = panelClass(view)
 	view.PingClass = pingClass(entry.PingMs)
 
@@ -144,7 +178,7 @@ func summarizeJobLatency(stats pingStats) jobSummary {
 	}
 }
 
-func collectIssues(entry *logEntry, workerShare, workerPercent float64) ([]issueDetail, int) {
+func collectIssues(entry *logEntry, workerShare int64) ([]issueDetail, int) {
 	var issues []issueDetail
 	severity := 0
 
@@ -174,11 +208,11 @@ func collectIssues(entry *logEntry, workerShare, workerPercent float64) ([]issue
 		}
 	}
 
-	if workerWalletPresent && workerPercent+0.001 < 98.0 {
-		msg := fmt.Sprintf("worker share %s%% below 98%%", formatTrimmedFloat(workerPercent, 2))
+	if workerWalletPresent && belowShare(workerShare, entry.TotalPayout, minWorkerShare) {
+		msg := fmt.Sprintf("worker share %s below %s", share(workerShare, entry.TotalPayout), minWorkerShare)
 		issues = append(issues, issueDetail{
 			Message:     msg,
-			Explanation: "Worker receives part of the reward but below 98%, which is unusually low.",
+			Explanation: fmt.Sprintf("Worker receives %s of %s BTC, below %s, which is unusually low.", formatBTC(workerShare), formatBTC(entry.TotalPayout), minWorkerShare),
 			Score:       severityLowShare,
 		})
 		if severityLowShare > severity {
@@ -186,6 +220,67 @@ func collectIssues(entry *logEntry, workerShare, workerPercent float64) ([]issue
 		}
 	}
 
+	var burned, unusual int64
+	for _, p := range entry.Payouts {
+		switch {
+		case p.Unspendable:
+			burned = addSats(burned, p.Amount)
+		case p.Type == stratum.ScriptWitnessUnknown || p.Type == stratum.ScriptNonStandard:
+			unusual = addSats(unusual, p.Amount)
+		}
+	}
+	if burned > 0 {
+		issues = append(issues, issueDetail{
+			Message:     fmt.Sprintf("coinbase burns %s BTC in unspendable outputs", formatBTC(burned)),
+			Explanation: "These outputs can never be spent, so their value is destroyed rather than paid to the worker or the pool.",
+			Score:       severityUnspendable,
+		})
+		if severityUnspendable > severity {
+			severity = severityUnspendable
+		}
+	}
+	if unusual > 0 {
+		issues = append(issues, issueDetail{
+			Message:     fmt.Sprintf("coinbase pays %s BTC to non-standard outputs", formatBTC(unusual)),
+			Explanation: "No ordinary wallet pays to these scripts. Outputs to witness versions no soft fork has defined yet can be spent by anyone until one does.",
+			Score:       severityUnusualOutput,
+		})
+		if severityUnusualOutput > severity {
+			severity = severityUnusualOutput
+		}
+	}
+
+	if entry.Abuse != "" {
+		issues = append(issues, issueDetail{
+			Message:     "hostile/abusive endpoint",
+			Explanation: fmt.Sprintf("The session was aborted after the pool exceeded the %s cap (%s). Oversized lines, message floods and endless streams are how a malicious endpoint exhausts a miner's memory.", strings.ReplaceAll(entry.Abuse, "_", " "), entry.Error),
+			Score:       severityHostile,
+		})
+		if severityHostile > severity {
+			severity = severityHostile
+		}
+	}
+
+	if entry.Header != nil {
+		for _, f := range entry.Header.Findings {
+			if f.Kind == headerNoVersionBits {
+				continue
+			}
+			issue := headerIssue(f)
+			issues = append(issues, issue)
+			if issue.Score > severity {
+				severity = issue.Score
+			}
+		}
+	}
+
+	for _, issue := range lintIssues(entry.Lint) {
+		issues = append(issues, issue)
+		if issue.Score > severity {
+			severity = issue.Score
+		}
+	}
+
 	if len(entry.Payouts) == 0 || entry.TotalPayout <= 0 {
 		if severityNoPayout > severity {
 			severity = severityNoPayout
@@ -195,14 +290,290 @@ func collectIssues(entry *logEntry, workerShare, workerPercent float64) ([]issue
 	return issues, severity
 }
 
-func rewardNoteAndClass(total, baseReward float64) (string, string) {
-	if total <= 0.00000001 {
+// lintIssues folds coinbase lint errors and warnings into one issue each;
+// informational findings only appear on the details page.
+func lintIssues(findings []lintFinding) []issueDetail {
+	var errs, warnings []string
+	for _, f := range findings {
+		switch f.Severity {
+		case stratum.LintError:
+			errs = append(errs, f.Message)
+		case stratum.LintWarning:
+			warnings = append(warnings, f.Message)
+		}
+	}
+	var issues []issueDetail
+	if len(errs) > 0 {
+		issues = append(issues, issueDetail{
+			Message:     "coinbase is structurally invalid",
+			Explanation: strings.Join(errs, "; ") + ". Nodes would reject a block built on this template.",
+			Score:       severityUnmineable,
+		})
+	}
+	if len(warnings) > 0 {
+		issues = append(issues, issueDetail{
+			Message:     fmt.Sprintf("coinbase lint: %d warning(s)", len(warnings)),
+			Explanation: strings.Join(warnings, "; ") + ".",
+			Score:       severityLintWarning,
+		})
+	}
+	return issues
+}
+
+// headerIssue explains a header validation finding.
+func headerIssue(f headerFinding) issueDetail {
+	switch f.Kind {
+	case headerBadBits:
+		return issueDetail{
+			Message:     "invalid nbits in job",
+			Explanation: f.Message + ". No header built from this job can meet a valid difficulty target, so the work is wasted.",
+			Score:       severityWrongBits,
+		}
+	case headerBadVersion:
+		return issueDetail{
+			Message:     "unexpected block version",
+			Explanation: f.Message + ". Nodes may reject the block or misread its deployment signals.",
+			Score:       severityBadVersion,
+		}
+	case headerBadNTime:
+		return issueDetail{
+			Message:     "job timestamp out of range",
+			Explanation: f.Message + ". Nodes reject headers more than two hours in the future, and a timestamp this old suggests the pool stopped refreshing its work.",
+			Score:       severityBadNTime,
+		}
+	case headerRollingBitSet:
+		return issueDetail{
+			Message:     "template sets version-rolling bits",
+			Explanation: f.Message + ". Miners that roll these bits (BIP310/BIP320) may overwrite them, and the pool must be able to reconstruct whatever they submit.",
+			Score:       severityRollingBits,
+		}
+	}
+	return issueDetail{
+		Message:     "job cannot be mined",
+		Explanation: "The block header could not be rebuilt from the job: " + f.Message + ". A miner cannot produce a valid block from it.",
+		Score:       severityUnmineable,
+	}
+}
+
+// addProfileIssue flags pools that pay identities differently.
+func addProfileIssue(view *entryView, cmp *profileComparison) {
+	view.Profiles = cmp
+	if cmp == nil || !cmp.Differs {
+		return
+	}
+	view.Issues = append(view.Issues, issueDetail{
+		Message:     "payout differs by miner identity",
+		Explanation: "Probing as different miners (" + strings.Join(profileNames(cmp), ", ") + ") returned different coinbases: " + strings.Join(cmp.Reasons, "; ") + ".",
+		Score:       severityDiscrimination,
+	})
+	if severityDiscrimination > view.IssueSeverity {
+		view.IssueSeverity = severityDiscrimination
+	}
+	view.PanelClass = panelClass(view)
+}
+
+// addAddressTypeIssues flags address types the pool refuses or accepts without
+// paying.
+func addAddressTypeIssues(view *entryView, checks []addressCheck) {
+	view.AddressChecks = checks
+	var rejected []string
+	for _, c := range checks {
+		if c.Authorize == authorizeRejected {
+			rejected = append(rejected, c.AddressType)
+		}
+	}
+	if unpaid := summarizeAddressChecks(checks); len(unpaid) > 0 {
+		view.Issues = append(view.Issues, issueDetail{
+			Message:     "accepts " + strings.Join(unpaid, ", ") + " wallets without paying them",
+			Explanation: "The pool authorized these address types and pays other types directly in the coinbase, but no output matches their scriptPubKey. A miner using them would not be paid.",
+			Score:       severityUnpaidAddressType,
+		})
+		if severityUnpaidAddressType > view.IssueSeverity {
+			view.IssueSeverity = severityUnpaidAddressType
+		}
+	}
+	if len(rejected) > 0 && len(rejected) < len(checks) {
+		view.Issues = append(view.Issues, issueDetail{
+			Message:     "rejects " + strings.Join(rejected, ", ") + " wallets",
+			Explanation: "mining.authorize failed for these address types while others were accepted.",
+			Score:       severityRejectedAddressType,
+		})
+		if severityRejectedAddressType > view.IssueSeverity {
+			view.IssueSeverity = severityRejectedAddressType
+		}
+	}
+	view.PanelClass = panelClass(view)
+}
+
+// addSafetyIssue flags pools that authorize usernames no block reward could be
+// paid to.
+func addSafetyIssue(view *entryView, checks []safetyCheck) {
+	view.SafetyChecks = checks
+	var accepted []string
+	for _, c := range checks {
+		if c.Authorize == authorizeAccepted {
+			accepted = append(accepted, c.Kind)
+		}
+	}
+	// Account-based pools pay their own wallet whatever the username, so
+	// accepting any username there is normal; the details page still lists
+	// the probes. Only a pool paying the worker's address can lose a block
+	// to a mistyped one.
+	if len(accepted) == 0 || view.WorkerShare == 0 {
+		return
+	}
+	view.Issues = append(view.Issues, issueDetail{
+		Message:     "accepts invalid payout address (" + strings.Join(accepted, ", ") + ")",
+		Explanation: "mining.authorize succeeded for a username that is not a valid address on the pool's network. A solo miner who mistypes their address here would lose any block they find.",
+		Score:       severityAcceptsGarbage,
+	})
+	if severityAcceptsGarbage > view.IssueSeverity {
+		view.IssueSeverity = severityAcceptsGarbage
+	}
+	view.PanelClass = panelClass(view)
+}
+
+// addFeeRankIssue flags a template whose fees trail far behind other pools'
+// templates at the same height.
+func addFeeRankIssue(view *entryView, rank *feeRank) {
+	view.FeeRank = rank
+	if rank == nil || !rank.Outlier {
+		return
+	}
+	view.Issues = append(view.Issues, issueDetail{
+		Message:     fmt.Sprintf("template fees %s BTC vs median %s BTC at height %d", formatBTC(rank.Fees), formatBTC(rank.Median), rank.Height),
+		Explanation: "Other pools scanned at the same block height offered considerably more in fees. The pool's template is small, stale or filtered, so a block found on it is worth less to a solo miner.",
+		Score:       severityFeeOutlier,
+	})
+	if severityFeeOutlier > view.IssueSeverity {
+		view.IssueSeverity = severityFeeOutlier
+	}
+	view.PanelClass = panelClass(view)
+}
+
+// addTipIssues flags a pool whose job does not build on the chain tip the
+// majority of pools agreed on, or builds on it with other nbits.
+func addTipIssues(view *entryView, check *tipCheck) {
+	view.TipCheck = check
+	if check == nil {
+		return
+	}
+	var issues []issueDetail
+	if check.Stale() {
+		message := fmt.Sprintf("job builds on a minority previous block at height %d", check.Height)
+		if check.Behind > 0 {
+			message = fmt.Sprintf("job at height %d is %d block(s) behind the tip at %d", check.Height, check.Behind, check.TipHeight)
+		}
+		issues = append(issues, issueDetail{
+			Message:     message,
+			Explanation: fmt.Sprintf("%d of %d pools scanned on this network agreed on the chain tip. Work on an older or competing block cannot extend the chain, so any hashrate pointed at this pool is wasted until it catches up.", check.Votes, check.Voters),
+			Score:       severityStaleTip,
+		})
+	}
+	if check.BitsMismatch {
+		issues = append(issues, issueDetail{
+			Message:     fmt.Sprintf("nbits %s differs from the %s used by most pools on the tip", check.Bits, check.TipBits),
+			Explanation: "The difficulty target is fixed by the chain. A block built on the same previous block with any other nbits is invalid, however much work it carries.",
+			Score:       severityWrongBits,
+		})
+	}
+	for _, issue := range issues {
+		view.Issues = append(view.Issues, issue)
+		if issue.Score > view.IssueSeverity {
+			view.IssueSeverity = issue.Score
+		}
+	}
+	if len(issues) > 0 {
+		view.PanelClass = panelClass(view)
+	}
+}
+
+// addNodeIssues flags where a pool's job disagrees with the local node's own
+// template for the same tip.
+func addNodeIssues(view *entryView, check *nodeCheck) {
+	view.NodeCheck = check
+	if check == nil {
+		return
+	}
+	var issues []issueDetail
+	if check.Stale {
+		issues = append(issues, issueDetail{
+			Message:     fmt.Sprintf("job at height %d does not build on the local node's tip (%d)", check.Height, check.NodeHeight-1),
+			Explanation: "The pool's previous block matches neither the tip the local node reported before the scan nor the one after it. Work on it cannot extend the chain.",
+			Score:       severityStaleTip,
+		})
+	}
+	if check.BitsMismatch {
+		issues = append(issues, issueDetail{
+			Message:     fmt.Sprintf("nbits %s differs from the local node's %s", check.Bits, check.NodeBits),
+			Explanation: "The difficulty target is fixed by the chain. A block built with any other nbits is invalid, however much work it carries.",
+			Score:       severityWrongBits,
+		})
+	}
+	if check.NTimeOutOfRange {
+		issues = append(issues, issueDetail{
+			Message:     fmt.Sprintf("ntime %d outside the node's valid range", check.NTime),
+			Explanation: "The header timestamp is earlier than the median time past or more than two hours ahead of the node's clock, so nodes would reject a block built on it.",
+			Score:       severityBadNTime,
+		})
+	}
+	if check.LowFees {
+		issues = append(issues, issueDetail{
+			Message:     fmt.Sprintf("template fees %s BTC vs %s BTC in the local node's template", formatBTC(check.Fees), formatBTC(check.NodeFees)),
+			Explanation: "The local node's own template for the same tip pays considerably more in fees. The pool's template is small or filtered, so a block found on it is worth less to a solo miner.",
+			Score:       severityFeeOutlier,
+		})
+	}
+	for _, issue := range issues {
+		view.Issues = append(view.Issues, issue)
+		if issue.Score > view.IssueSeverity {
+			view.IssueSeverity = issue.Score
+		}
+	}
+	if len(issues) > 0 {
+		view.PanelClass = panelClass(view)
+	}
+}
+
+func profileNames(cmp *profileComparison) []string {
+	names := make([]string, 0, len(cmp.Views))
+	for _, v := range cmp.Views {
+		names = append(names, v.Profile)
+	}
+	return names
+}
+
+// addLowFeeIssue flags mainnet templates whose fees are a sliver of the
+// subsidy. Test networks routinely mine empty blocks, so they are skipped.
+func addLowFeeIssue(view *entryView, entry *logEntry) {
+	if !view.HasSubsidy || entry.TotalPayout < view.Subsidy || firstNonEmpty(entry.Network, networkMainnet) != networkMainnet {
+		return
+	}
+	if !belowShare(view.Fees, view.Subsidy, lowFeeShare) {
+		return
+	}
+	view.Issues = append(view.Issues, issueDetail{
+		Message:     fmt.Sprintf("template carries only %s BTC in fees", formatBTC(view.Fees)),
+		Explanation: "The coinbase pays little beyond the block subsidy, so the pool's template includes few or no fee-paying transactions. A block found on it earns less than on a full template.",
+		Score:       severityLowFees,
+	})
+	if severityLowFees > view.IssueSeverity {
+		view.IssueSeverity = severityLowFees
+	}
+	view.PanelClass = panelClass(view)
+}
+
+func rewardNoteAndClass(total, subsidy int64, hasSubsidy bool) (string, string) {
+	if total <= 0 {
 		return "Payout not recorded yet", "reward-red"
 	}
-	if total > baseReward {
+	if !hasSubsidy {
+		return "Block height unknown; subsidy not checked", ""
+	}
+	if total >= subsidy {
 		return "Total payout amount correct", "reward-blue"
 	}
-	return fmt.Sprintf("Total payout less than block reward (%s BTC)", formatTrimmedFloat(total, 8)), "reward-red"
+	return fmt.Sprintf("Total payout less than block reward (%s BTC)", formatBTC(total)), "reward-red"
 }
 
 func panelClass(entry *entryView) string {
@@ -297,11 +668,3 @@ func walletDisplay(addr string) string {
 	}
 	return addr[:keepPrefix] + "..." + addr[len(addr)-keepSuffix:]
 }
-
-func blockchainAddressURL(addr string) string {
-	addr = strings.TrimSpace(addr)
-	if addr == "" {
-		return ""
-	}
-	return "https://www.blockchain.com/explorer/addresses/btc/" + url.PathEscape(addr)
-}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+const (
+	// feeOutlierShare flags pools whose template fees fall below this share
+	// of the median fees offered by other pools at the same height.
+	feeOutlierShare percentage = 5000
+	// minFeePeers is how many pools must share a height before fees are
+	// ranked; with fewer, the median says little.
+	minFeePeers = 3
+)
+
+// feePeer is one pool's template at a shared height.
+type feePeer struct {
+	Pool string
+	Fees int64
+	Self bool
+}
+
+// feeRank places one pool's template fees among every pool scanned at the
+// same network and block height, highest fees first.
+type feeRank struct {
+	Height  uint32
+	Rank    int
+	Of      int
+	Fees    int64
+	Median  int64
+	Outlier bool
+	Peers   []feePeer
+}
+
+// rankFees groups the aggregates' latest templates by network and height and
+// ranks each pool by its fees, i.e. total payout minus the block subsidy.
+func rankFees(aggregates []*scanAggregate) {
+	type member struct {
+		agg  *scanAggregate
+		peer feePeer
+	}
+	groups := make(map[string][]member)
+	for _, agg := range aggregates {
+		entry := agg.latest
+		if entry == nil || !entry.Connected || entry.BlockHeight == 0 || entry.TotalPayout <= 0 {
+			continue
+		}
+		network := firstNonEmpty(entry.Network, networkMainnet)
+		subsidy := blockSubsidy(networkParams(network), entry.BlockHeight)
+		pool := firstNonEmpty(entry.PoolTag, entry.Host)
+		key := fmt.Sprintf("%s/%d", network, entry.BlockHeight)
+		groups[key] = append(groups[key], member{agg: agg, peer: feePeer{Pool: pool, Fees: entry.TotalPayout - subsidy}})
+	}
+
+	for _, members := range groups {
+		if len(members) < minFeePeers {
+			continue
+		}
+		sort.SliceStable(members, func(i, j int) bool {
+			return members[i].peer.Fees > members[j].peer.Fees
+		})
+		peers := make([]feePeer, len(members))
+		for i, m := range members {
+			peers[i] = m.peer
+		}
+		median := medianFees(peers)
+		for i, m := range members {
+			own := make([]feePeer, len(peers))
+			copy(own, peers)
+			own[i].Self = true
+			m.agg.feeRank = &feeRank{
+				Height:  m.agg.latest.BlockHeight,
+				Rank:    i + 1,
+				Of:      len(members),
+				Fees:    m.peer.Fees,
+				Median:  median,
+				Outlier: belowShare(m.peer.Fees, median, feeOutlierShare),
+				Peers:   own,
+			}
+		}
+	}
+}
+
+// medianFees expects peers sorted by fees. An even count averages the middle
+// two, rounding down to the satoshi.
+func medianFees(peers []feePeer) int64 {
+	n := len(peers)
+	if n%2 == 1 {
+		return peers[n/2].Fees
+	}
+	a, b := peers[n/2-1].Fees, peers[n/2].Fees
+	return a/2 + b/2 + (a%2+b%2)/2
+}
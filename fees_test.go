@@ -0,0 +1,33 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestMedianFees(t *testing.T) {
+	peers := func(fees ...int64) []feePeer {
+		out := make([]feePeer, len(fees))
+		for i, f := range fees {
+			out[i] = feePeer{Pool: "pool", Fees: f}
+		}
+		return out
+	}
+	tests := []struct {
+		name  string
+		peers []feePeer
+		want  int64
+	}{
+		{"one", peers(5), 5},
+		{"odd", peers(1, 5, 9), 5},
+		{"even", peers(1, 4, 6, 100), 5},
+		{"even rounds down", peers(10, 15), 12},
+		{"even both odd", peers(3, 5), 4},
+		{"even near the int64 limit", peers(math.MaxInt64-1, math.MaxInt64), math.MaxInt64 - 1},
+	}
+	for _, tt := range tests {
+		if got := medianFees(tt.peers); got != tt.want {
+			t.Errorf("%s: medianFees = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
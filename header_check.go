@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/chaincfg"
+
+	"poolcensus/desktop/stratum"
+)
+
+const (
+	headerMalformed     = "malformed"
+	headerBadBits       = "nbits"
+	headerBadVersion    = "version"
+	headerBadNTime      = "ntime"
+	headerRollingBitSet = "version_rolling"
+	// headerNoVersionBits is informational: a version of 4 or more without
+	// the BIP9 top bits is valid, it just signals no deployments.
+	headerNoVersionBits = "version_bits"
+)
+
+const (
+	// versionBitsMask and versionBitsTop select the BIP9 top bits, which must
+	// read 001 for the remaining bits to signal deployments.
+	versionBitsMask = 0xe0000000
+	versionBitsTop  = 0x20000000
+	// versionRollingMask is the BIP320 general purpose range miners may roll;
+	// a template should leave it clear.
+	versionRollingMask = 0x1fffe000
+	// maxStaleNTime is how far behind the scan clock a job's ntime may lag;
+	// an older timestamp means the pool stopped refreshing its work.
+	maxStaleNTime = time.Hour
+)
+
+// validateHeader rebuilds the header a miner would hash for the job and
+// checks it can yield a valid block on params at height.
+func validateHeader(params *stratum.NotifyParams, fullCoinbase string, chain *chaincfg.Params, height uint32, now time.Time) *headerData {
+	data := &headerData{
+		Version:      params.Version,
+		NBits:        params.NBits,
+		NTime:        params.NTime,
+		MerkleBranch: params.MerkleBranch,
+	}
+	if fullCoinbase == "" {
+		data.add(headerMalformed, "coinbase does not decode, so the merkle root cannot be built")
+	} else if header, err := stratum.BuildHeader(params, fullCoinbase); err != nil {
+		data.add(headerMalformed, err.Error())
+	} else if raw, err := stratum.SerializeHeader(header); err != nil {
+		data.add(headerMalformed, err.Error())
+	} else {
+		data.MerkleRoot = header.MerkleRoot.String()
+		data.Hex = hex.EncodeToString(raw)
+	}
+
+	// The fields are checked even when the header could not be built, so a
+	// broken job reports everything wrong with it at once.
+	if bits, ok := parseWord(params.NBits); ok {
+		target := blockchain.CompactToBig(bits)
+		switch {
+		case bits&0x00800000 != 0 || target.Sign() <= 0:
+			data.add(headerBadBits, fmt.Sprintf("nbits %s is not a positive compact target", params.NBits))
+		case target.Cmp(chain.PowLimit) > 0:
+			data.add(headerBadBits, fmt.Sprintf("nbits %s is easier than %s's proof-of-work limit", params.NBits, chain.Name))
+		}
+	}
+
+	if version, ok := parseWord(params.Version); ok {
+		switch {
+		case height >= uint32(chain.BIP0065Height) && int32(version) < 4:
+			data.add(headerBadVersion, fmt.Sprintf("version %d is below 4, which nodes reject since BIP65", int32(version)))
+		case version&versionBitsMask != versionBitsTop:
+			data.add(headerNoVersionBits, fmt.Sprintf("version %08x does not start with the BIP9 top bits 001, so it signals no deployments", version))
+		}
+		if version&versionRollingMask != 0 {
+			data.add(headerRollingBitSet, fmt.Sprintf("version %08x sets BIP320 bits %08x reserved for miners' version rolling", version, version&versionRollingMask))
+		}
+	}
+
+	if word, ok := parseWord(params.NTime); ok {
+		switch ntime := time.Unix(int64(word), 0); {
+		case ntime.After(now.Add(maxFutureNTime)):
+			data.add(headerBadNTime, fmt.Sprintf("ntime is %s ahead of our clock", ntime.Sub(now).Round(time.Second)))
+		case ntime.Before(now.Add(-maxStaleNTime)):
+			data.add(headerBadNTime, fmt.Sprintf("ntime is %s behind our clock", now.Sub(ntime).Round(time.Second)))
+		}
+	}
+	return data
+}
+
+func parseWord(s string) (uint32, bool) {
+	v, err := strconv.ParseUint(s, 16, 32)
+	return uint32(v), err == nil
+}
+
+func (d *headerData) add(kind, message string) {
+	d.Findings = append(d.Findings, headerFinding{Kind: kind, Message: message})
+}
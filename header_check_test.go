@@ -0,0 +1,57 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg"
+
+	"poolcensus/desktop/stratum"
+)
+
+func TestValidateHeaderVersion(t *testing.T) {
+	now := time.Unix(1735689600, 0)
+	tests := []struct {
+		name    string
+		version string
+		height  uint32
+		want    []string
+		issues  []string
+	}{
+		{"bip9", "20000000", nodeTestHeight, nil, nil},
+		{"no version bits", "00000004", nodeTestHeight, []string{headerNoVersionBits}, nil},
+		{"below 4", "00000003", nodeTestHeight, []string{headerBadVersion}, []string{"unexpected block version"}},
+		{"below 4 before bip65", "00000003", 100000, []string{headerNoVersionBits}, nil},
+		{"rolling bits", "20002000", nodeTestHeight, []string{headerRollingBitSet}, []string{"template sets version-rolling bits"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params := &stratum.NotifyParams{
+				Version: tt.version,
+				NBits:   nodeTestBits,
+				NTime:   "67748580",
+			}
+			data := validateHeader(params, "", &chaincfg.MainNetParams, tt.height, now)
+			var kinds []string
+			for _, f := range data.Findings {
+				if f.Kind != headerMalformed {
+					kinds = append(kinds, f.Kind)
+				}
+			}
+			assertStrings(t, "findings", kinds, tt.want)
+
+			// Informational findings stay on the details page and raise no
+			// issue; the empty coinbase's own issue is left out.
+			data.Findings = data.Findings[1:]
+			issues, _ := collectIssues(&logEntry{Connected: true, Header: data}, 0)
+			var got []string
+			for _, issue := range issues {
+				if strings.Contains(issue.Explanation, "version ") {
+					got = append(got, issue.Message)
+				}
+			}
+			assertStrings(t, "issues", got, tt.issues)
+		})
+	}
+}
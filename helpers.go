@@ -14,14 +14,15 @@ func dominantPoolWallet(entry *logEntry) (string, bool) {
 	if entry == nil || len(entry.Payouts) == 0 {
 		return "", false
 	}
+	workerScript := addressScript(entry.WalletAddress, networkParams(entry.Network))
 	var bestAddr string
-	bestAmount := -1.0
+	bestAmount := int64(-1)
 	for _, payout := range entry.Payouts {
 		addr := strings.TrimSpace(payout.Address)
 		if addr == "" {
 			continue
 		}
-		if entry.WalletAddress != "" && addr == entry.WalletAddress {
+		if paysScript(payout, entry.WalletAddress, workerScript) {
 			continue
 		}
 		if payout.Amount > bestAmount {
@@ -46,7 +47,7 @@ func payoutSummary(entry *logEntry) string {
 		if i >= maxOutputs {
 			break
 		}
-		addr := normalizePayoutAddress(entry, p.Address)
+		addr := normalizePayoutAddress(entry, p.Target())
 		display := addr
 		if addr != "<worker>" && addr != "<none>" {
 			display = summarizeString(addr, 18)
@@ -57,9 +58,9 @@ func payoutSummary(entry *logEntry) string {
 		}
 		percent := "n/a"
 		if entry.TotalPayout > 0 {
-			percent = formatTrimmedFloat((p.Amount/entry.TotalPayout)*100, 2) + "%"
+			percent = share(p.Amount, entry.TotalPayout).String()
 		}
-		lines = append(lines, fmt.Sprintf("#%d %s (%s) %s (%s)", p.OutputIndex, formatTrimmedFloat(p.Amount, 8), percent, display, typ))
+		lines = append(lines, fmt.Sprintf("#%d %s (%s) %s (%s)", p.OutputIndex, formatBTC(p.Amount), percent, display, typ))
 	}
 	if len(entry.Payouts) > maxOutputs {
 		lines = append(lines, fmt.Sprintf("+%d more", len(entry.Payouts)-maxOutputs))
@@ -78,6 +79,15 @@ func normalizePayoutAddress(entry *logEntry, addr string) string {
 	return addr
 }
 
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
 func isEmptyish(s string) bool {
 	switch strings.TrimSpace(s) {
 	case "", "<none>", "n/a":
@@ -122,11 +132,11 @@ func formatTrimmedFloat(f float64, decimals int) string {
 	return s
 }
 
-func extractPoolTag(coinbase2Hex string) string {
-	if coinbase2Hex == "" {
+func extractPoolTag(coinbaseHex string) string {
+	if coinbaseHex == "" {
 		return ""
 	}
-	raw, err := hex.DecodeString(coinbase2Hex)
+	raw, err := hex.DecodeString(coinbaseHex)
 	if err != nil || len(raw) == 0 {
 		return ""
 	}
@@ -3,10 +3,12 @@ package main
 import (
 	"fmt"
 	"math/rand"
+	"strings"
 
-	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
 	"github.com/btcsuite/btcd/btcutil"
 	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
 )
 
 var agentStrings = []string{
@@ -20,11 +22,11 @@ var agentStrings = []string{
 	"vellamo/1.0",
 }
 
-func loadRandomAgent() string {
-	return agentStrings[rand.Intn(len(agentStrings))]
+func loadRandomAgent(r *rand.Rand) string {
+	return agentStrings[r.Intn(len(agentStrings))]
 }
 
-func generateWorkerName() string {
+func generateWorkerName(r *rand.Rand) string {
 	patterns := []string{
 		"worker-%d",
 		"rig-%d",
@@ -38,25 +40,128 @@ func generateWorkerName() string {
 		"worker",
 		"mining",
 	}
-	pattern := patterns[rand.Intn(len(patterns))]
+	pattern := patterns[r.Intn(len(patterns))]
 	for i := 0; i < len(pattern)-1; i++ {
 		if pattern[i] == '%' && pattern[i+1] == 'd' {
-			return fmt.Sprintf(pattern, rand.Intn(100))
+			return fmt.Sprintf(pattern, r.Intn(100))
 		}
 	}
 	return pattern
 }
 
-func generateRandomWallet() (string, error) {
-	privateKey, err := btcec.NewPrivateKey()
-	if err != nil {
-		return "", fmt.Errorf("failed to generate private key: %w", err)
-	}
-	pubKey := privateKey.PubKey()
+func generateRandomWallet(r *rand.Rand) (string, error) {
+	return generateWallet(r, addressP2PKH)
+}
+
+const (
+	addressP2PKH      = "p2pkh"
+	addressP2SHP2WPKH = "p2sh-p2wpkh"
+	addressP2WPKH     = "p2wpkh"
+	addressP2TR       = "p2tr"
+)
+
+// walletAddressTypes lists every type generateWallet can produce, oldest first.
+var walletAddressTypes = []string{addressP2PKH, addressP2SHP2WPKH, addressP2WPKH, addressP2TR}
+
+// generateWallet returns a fresh address of the given type on the run's
+// network, keyed from r.
+func generateWallet(r *rand.Rand, addressType string) (string, error) {
+	return generateWalletOn(r, networkParams(runNetwork), addressType)
+}
+
+// generateWalletOn returns a fresh address of the given type for params,
+// keyed from r.
+func generateWalletOn(r *rand.Rand, params *chaincfg.Params, addressType string) (string, error) {
+	pubKey := newPrivateKey(r).PubKey()
 	pubKeyHash := btcutil.Hash160(pubKey.SerializeCompressed())
-	address, err := btcutil.NewAddressPubKeyHash(pubKeyHash, &chaincfg.MainNetParams)
+	var (
+		address btcutil.Address
+		err     error
+	)
+	switch addressType {
+	case addressP2PKH:
+		address, err = btcutil.NewAddressPubKeyHash(pubKeyHash, params)
+	case addressP2SHP2WPKH:
+		// BIP49: the redeem script is the P2WPKH witness program.
+		redeemScript := append([]byte{txscript.OP_0, txscript.OP_DATA_20}, pubKeyHash...)
+		address, err = btcutil.NewAddressScriptHash(redeemScript, params)
+	case addressP2WPKH:
+		address, err = btcutil.NewAddressWitnessPubKeyHash(pubKeyHash, params)
+	case addressP2TR:
+		// BIP86: key-path only, tweaked with an empty script tree.
+		outputKey := txscript.ComputeTaprootKeyNoScript(pubKey)
+		address, err = btcutil.NewAddressTaproot(schnorr.SerializePubKey(outputKey), params)
+	default:
+		return "", fmt.Errorf("unknown address type %q", addressType)
+	}
 	if err != nil {
 		return "", fmt.Errorf("failed to create address: %w", err)
 	}
 	return address.EncodeAddress(), nil
 }
+
+// identityProfile describes a class of miner a pool might treat differently.
+type identityProfile struct {
+	Name        string
+	Agents      []string
+	Workers     []string
+	AddressType string
+}
+
+var identityProfiles = []identityProfile{
+	{
+		Name:        "cgminer",
+		Agents:      []string{"cgminer/4.10.0", "cgminer/4.11.1", "cgminer/4.12.0"},
+		Workers:     []string{"s19", "rig-%d", "worker%d"},
+		AddressType: addressP2PKH,
+	},
+	{
+		Name:        "Bitaxe (AxeOS)",
+		Agents:      []string{"bitaxe/BM1366/v2.4.2", "bitaxe/BM1368/v2.5.0", "bitaxe/BM1370/v2.6.1"},
+		Workers:     []string{"bitaxe", "gamma%d", "supra%d"},
+		AddressType: addressP2WPKH,
+	},
+	{
+		Name:        "Braiins OS",
+		Agents:      []string{"bosminer/23.12.1", "bosminer/24.03.2", "bosminer-plus-tuner/24.09"},
+		Workers:     []string{"s19jpro%d", "s21-%d", "am2-%d"},
+		AddressType: addressP2WPKH,
+	},
+}
+
+// minerIdentity is one concrete identity used to authorize with a pool.
+type minerIdentity struct {
+	Profile     string
+	Agent       string
+	Worker      string
+	Wallet      string
+	AddressType string
+}
+
+func (id minerIdentity) Username() string {
+	return id.Wallet + "." + id.Worker
+}
+
+// newProfileIdentities draws one identity per profile, each with its own
+// wallet so the coinbases can be told apart. Every draw comes from r.
+func newProfileIdentities(r *rand.Rand) ([]minerIdentity, error) {
+	ids := make([]minerIdentity, 0, len(identityProfiles))
+	for _, p := range identityProfiles {
+		wallet, err := generateWallet(r, p.AddressType)
+		if err != nil {
+			return nil, err
+		}
+		worker := p.Workers[r.Intn(len(p.Workers))]
+		if strings.Contains(worker, "%d") {
+			worker = fmt.Sprintf(worker, r.Intn(100))
+		}
+		ids = append(ids, minerIdentity{
+			Profile:     p.Name,
+			Agent:       p.Agents[r.Intn(len(p.Agents))],
+			Worker:      worker,
+			Wallet:      wallet,
+			AddressType: p.AddressType,
+		})
+	}
+	return ids, nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcd/btcutil"
+)
+
+func TestProfileIdentitiesUseProfileAddressType(t *testing.T) {
+	ids, err := newProfileIdentities(newStream(streamProfiles))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != len(identityProfiles) {
+		t.Fatalf("%d identities for %d profiles", len(ids), len(identityProfiles))
+	}
+	wallets := make(map[string]bool)
+	for i, id := range ids {
+		want := identityProfiles[i].AddressType
+		if id.AddressType != want {
+			t.Errorf("%s: address type %s, want %s", id.Profile, id.AddressType, want)
+		}
+		addr, err := btcutil.DecodeAddress(id.Wallet, networkParams(runNetwork))
+		if err != nil {
+			t.Fatalf("%s: %v", id.Profile, err)
+		}
+		if got := addressTypeOf(addr); got != want {
+			t.Errorf("%s: wallet %s is %s, want %s", id.Profile, id.Wallet, got, want)
+		}
+		if wallets[id.Wallet] {
+			t.Errorf("%s: wallet %s reused", id.Profile, id.Wallet)
+		}
+		wallets[id.Wallet] = true
+	}
+}
+
+// addressTypeOf names the generateWallet type addr was made as. A P2SH
+// address is assumed to wrap P2WPKH, the only P2SH type generated.
+func addressTypeOf(addr btcutil.Address) string {
+	switch addr.(type) {
+	case *btcutil.AddressPubKeyHash:
+		return addressP2PKH
+	case *btcutil.AddressScriptHash:
+		return addressP2SHP2WPKH
+	case *btcutil.AddressWitnessPubKeyHash:
+		return addressP2WPKH
+	case *btcutil.AddressTaproot:
+		return addressP2TR
+	}
+	return ""
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+)
+
+const networkMainnet = "mainnet"
+
+var networkParamsByName = map[string]*chaincfg.Params{
+	networkMainnet: &chaincfg.MainNetParams,
+	"testnet":      &chaincfg.TestNet3Params,
+	"testnet3":     &chaincfg.TestNet3Params,
+	"testnet4":     &chaincfg.TestNet4Params,
+	"signet":       &chaincfg.SigNetParams,
+	"regtest":      &chaincfg.RegressionNetParams,
+}
+
+// runNetwork is the -network setting, used for pools that do not name one.
+var runNetwork = networkMainnet
+
+// normalizeNetwork maps an empty or aliased name to its canonical form.
+func normalizeNetwork(name string) (string, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		return networkMainnet, nil
+	}
+	params, ok := networkParamsByName[name]
+	if !ok {
+		return "", fmt.Errorf("unknown network %q (want mainnet, testnet, testnet4, signet or regtest)", name)
+	}
+	if params == &chaincfg.TestNet3Params {
+		return "testnet3", nil
+	}
+	return name, nil
+}
+
+// networkParams returns the chain parameters for a canonical network name;
+// unknown and empty names fall back to mainnet.
+func networkParams(name string) *chaincfg.Params {
+	if params, ok := networkParamsByName[name]; ok {
+		return params
+	}
+	return &chaincfg.MainNetParams
+}
+
+// walletOnNetwork re-encodes a wallet for params, keeping its key or script
+// hash. The run's generated identity is one key, so every pool sees the same
+// owner regardless of its network. Invalid wallets are returned unchanged.
+func walletOnNetwork(wallet string, params *chaincfg.Params) string {
+	addr, err := decodeAnyNetwork(wallet)
+	if err != nil || addr.IsForNet(params) {
+		return wallet
+	}
+	var converted btcutil.Address
+	switch a := addr.(type) {
+	case *btcutil.AddressPubKeyHash:
+		converted, err = btcutil.NewAddressPubKeyHash(a.ScriptAddress(), params)
+	case *btcutil.AddressScriptHash:
+		converted, err = btcutil.NewAddressScriptHashFromHash(a.ScriptAddress(), params)
+	case *btcutil.AddressWitnessPubKeyHash:
+		converted, err = btcutil.NewAddressWitnessPubKeyHash(a.ScriptAddress(), params)
+	case *btcutil.AddressWitnessScriptHash:
+		converted, err = btcutil.NewAddressWitnessScriptHash(a.ScriptAddress(), params)
+	case *btcutil.AddressTaproot:
+		converted, err = btcutil.NewAddressTaproot(a.ScriptAddress(), params)
+	default:
+		return wallet
+	}
+	if err != nil {
+		return wallet
+	}
+	return converted.EncodeAddress()
+}
+
+// identityOnNetwork converts the wallet in a wallet.worker username along
+// with the wallet itself.
+func identityOnNetwork(username, wallet string, params *chaincfg.Params) (string, string) {
+	converted := walletOnNetwork(wallet, params)
+	if converted == wallet {
+		return username, wallet
+	}
+	return strings.Replace(username, wallet, converted, 1), converted
+}
+
+func decodeAnyNetwork(wallet string) (btcutil.Address, error) {
+	var lastErr error
+	for _, params := range []*chaincfg.Params{&chaincfg.MainNetParams, &chaincfg.TestNet3Params, &chaincfg.RegressionNetParams} {
+		addr, err := btcutil.DecodeAddress(wallet, params)
+		if err == nil {
+			return addr, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// explorerAddressURL links an address on a public explorer for its network;
+// regtest has none.
+func explorerAddressURL(network, addr string) string {
+	addr = strings.TrimSpace(addr)
+	if addr == "" {
+		return ""
+	}
+	switch network {
+	case "", networkMainnet:
+		return "https://www.blockchain.com/explorer/addresses/btc/" + url.PathEscape(addr)
+	case "testnet3", "testnet4", "signet":
+		path := network
+		if network == "testnet3" {
+			path = "testnet"
+		}
+		return "https://mempool.space/" + path + "/address/" + url.PathEscape(addr)
+	}
+	return ""
+}
+
+// blockSubsidy is the block subsidy in satoshis at height on params' schedule.
+func blockSubsidy(params *chaincfg.Params, height uint32) int64 {
+	const initial = 50 * btcutil.SatoshiPerBitcoin
+	if params.SubsidyReductionInterval <= 0 {
+		return initial
+	}
+	halvings := int32(height) / params.SubsidyReductionInterval
+	if halvings >= 64 {
+		return 0
+	}
+	return initial >> uint(halvings)
+}
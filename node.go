@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"poolcensus/desktop/bitcoind"
+)
+
+// maxFutureNTime is how far ahead of the node's clock a header timestamp may
+// be before nodes reject the block.
+const maxFutureNTime = 2 * time.Hour
+
+// nodeChainNetworks maps getblockchaininfo's chain names to ours.
+var nodeChainNetworks = map[string]string{
+	"main":     networkMainnet,
+	"test":     "testnet3",
+	"testnet4": "testnet4",
+	"signet":   "signet",
+	"regtest":  "regtest",
+}
+
+// nodeSnapshot is the local node's own template at one moment.
+type nodeSnapshot struct {
+	Network  string
+	Taken    time.Time
+	BestHash string
+	Template *bitcoind.BlockTemplate
+}
+
+func (s *nodeSnapshot) Fees() int64 {
+	return s.Template.CoinbaseValue - blockSubsidy(networkParams(s.Network), s.Template.Height)
+}
+
+// nodeCheck compares one pool's job with the local node's template at the
+// same tip, or with the latest template if the pool matched none.
+type nodeCheck struct {
+	NodeHeight   uint32
+	NodePrevHash string
+	NodeBits     string
+	NodeCoinbase int64
+	NodeFees     int64
+	NodeMinTime  int64
+	NodeTime     int64
+
+	Height   uint32
+	PrevHash string
+	Bits     string
+	NTime    int64
+	Coinbase int64
+	Fees     int64
+
+	Stale           bool
+	BitsMismatch    bool
+	NTimeOutOfRange bool
+	LowFees         bool
+}
+
+// newNodeClient connects to -node-rpc, reading credentials from cookiePath
+// when one is given.
+func newNodeClient(endpoint, cookiePath string) (*bitcoind.Client, error) {
+	var opts []bitcoind.Option
+	if cookiePath != "" {
+		cookie, err := os.ReadFile(cookiePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read RPC cookie: %w", err)
+		}
+		user, password, ok := strings.Cut(strings.TrimSpace(string(cookie)), ":")
+		if !ok {
+			return nil, fmt.Errorf("RPC cookie %s is not user:password", cookiePath)
+		}
+		opts = append(opts, bitcoind.WithAuth(user, password))
+	}
+	return bitcoind.NewClient(endpoint, opts...)
+}
+
+// takeNodeSnapshot asks the node for its chain, tip and block template.
+func takeNodeSnapshot(client *bitcoind.Client) (*nodeSnapshot, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+	defer cancel()
+	info, err := client.BlockchainInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	network, ok := nodeChainNetworks[info.Chain]
+	if !ok {
+		return nil, fmt.Errorf("node reports unknown chain %q", info.Chain)
+	}
+	rules := []string{"segwit"}
+	if network == "signet" {
+		rules = append(rules, "signet")
+	}
+	tmpl, err := client.BlockTemplate(ctx, rules)
+	if err != nil {
+		return nil, err
+	}
+	best, err := client.BestBlockHash(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &nodeSnapshot{Network: network, Taken: time.Now(), BestHash: best, Template: tmpl}, nil
+}
+
+// compareWithNode checks every aggregate on the node's network against the
+// snapshots taken before and after the scan. A pool is fresh if it builds on
+// either snapshot's tip, since a block may arrive while pools are scanned.
+func compareWithNode(aggregates []*scanAggregate, snapshots []*nodeSnapshot) {
+	if len(snapshots) == 0 {
+		return
+	}
+	latest := snapshots[len(snapshots)-1]
+	for _, agg := range aggregates {
+		entry := agg.latest
+		if entry == nil || !entry.Connected || entry.CoinbaseRaw == nil {
+			continue
+		}
+		if firstNonEmpty(entry.Network, networkMainnet) != latest.Network {
+			continue
+		}
+		snap, matched := latest, false
+		for _, s := range snapshots {
+			if buildsOn(entry, s) {
+				snap, matched = s, true
+			}
+		}
+		agg.nodeCheck = checkAgainstNode(entry, snap, matched)
+	}
+}
+
+// buildsOn reports whether entry's job extends the snapshot's best block.
+// Pools that sent no usable prevhash are matched on height alone.
+func buildsOn(entry *logEntry, s *nodeSnapshot) bool {
+	if entry.PrevHash != "" {
+		return strings.EqualFold(entry.PrevHash, firstNonEmpty(s.BestHash, s.Template.PreviousBlockHash))
+	}
+	return entry.BlockHeight == s.Template.Height
+}
+
+func checkAgainstNode(entry *logEntry, snap *nodeSnapshot, matched bool) *nodeCheck {
+	tmpl := snap.Template
+	check := &nodeCheck{
+		NodeHeight:   tmpl.Height,
+		NodePrevHash: tmpl.PreviousBlockHash,
+		NodeBits:     strings.ToLower(tmpl.Bits),
+		NodeCoinbase: tmpl.CoinbaseValue,
+		NodeFees:     snap.Fees(),
+		NodeMinTime:  tmpl.MinTime,
+		NodeTime:     tmpl.CurTime,
+		Height:       entry.BlockHeight,
+		PrevHash:     entry.PrevHash,
+		Bits:         entry.NBits,
+		Coinbase:     entry.TotalPayout,
+		Stale:        !matched,
+	}
+	if entry.BlockHeight > 0 {
+		check.Fees = entry.TotalPayout - blockSubsidy(networkParams(snap.Network), entry.BlockHeight)
+	}
+	if !matched {
+		return check
+	}
+	check.BitsMismatch = entry.NBits != "" && entry.NBits != check.NodeBits
+	if ntime, ok := parseWord(entry.NTime); ok {
+		check.NTime = int64(ntime)
+		check.NTimeOutOfRange = check.NTime < tmpl.MinTime || check.NTime > snap.Taken.Add(maxFutureNTime).Unix()
+	}
+	check.LowFees = entry.TotalPayout > 0 && belowShare(check.Fees, check.NodeFees, feeOutlierShare)
+	return check
+}
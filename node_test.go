@@ -0,0 +1,213 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/wire"
+
+	"poolcensus/desktop/bitcoind"
+	"poolcensus/desktop/bitcoind/bitcoindtest"
+	"poolcensus/desktop/stratum/stratumtest"
+)
+
+const (
+	nodeTestHeight = 900000
+	nodeTestBits   = "17023a04"
+	nodeTestFees   = 5000000
+	nodeTestTip    = "000000000000000000010a2cb7ad5b5ac2a3c1a9c1e1c0e0f0a0b0c0d0e0f001"
+)
+
+// stratumPrevHash encodes a display-order block hash the way mining.notify
+// carries it: the 4-byte words in reverse order.
+func stratumPrevHash(display string) string {
+	var words []string
+	for i := len(display) - 8; i >= 0; i -= 8 {
+		words = append(words, display[i:i+8])
+	}
+	return strings.Join(words, "")
+}
+
+func nodeTestNode(tip string, height uint32, now time.Time) bitcoindtest.Node {
+	return bitcoindtest.Node{
+		Chain:         "main",
+		BestBlockHash: tip,
+		User:          "census",
+		Password:      "secret",
+		Template: bitcoind.BlockTemplate{
+			PreviousBlockHash: tip,
+			Height:            height,
+			Bits:              nodeTestBits,
+			CoinbaseValue:     blockSubsidy(&chaincfg.MainNetParams, height) + nodeTestFees,
+			MinTime:           now.Add(-time.Hour).Unix(),
+			CurTime:           now.Unix(),
+		},
+	}
+}
+
+// nodeTestClient starts a node and returns a client authenticated through a
+// cookie file, as -node-cookie would.
+func nodeTestClient(t *testing.T, node bitcoindtest.Node) (*bitcoindtest.Server, *bitcoind.Client) {
+	t.Helper()
+	srv := bitcoindtest.NewServer(node)
+	t.Cleanup(srv.Close)
+	cookie := filepath.Join(t.TempDir(), ".cookie")
+	if err := os.WriteFile(cookie, []byte(node.User+":"+node.Password+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	client, err := newNodeClient(srv.URL(), cookie)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return srv, client
+}
+
+// poolJob scans a stratumtest pool serving one job and returns its entry.
+func poolJob(t *testing.T, wallet string, height int64, value int64, job stratumtest.Job) *logEntry {
+	t.Helper()
+	c1, c2, err := stratumtest.BuildCoinbase(height, "/node/", 12, []*wire.TxOut{wire.NewTxOut(value, addressScript(wallet, &chaincfg.MainNetParams))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	job.CoinBase1, job.CoinBase2 = c1, c2
+	sc := stratumtest.DefaultScenario()
+	sc.Jobs = []stratumtest.Job{job}
+	entry, err := scanScenario(t, sc, wallet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return entry
+}
+
+func TestTakeNodeSnapshot(t *testing.T) {
+	now := time.Now()
+	node := nodeTestNode(nodeTestTip, nodeTestHeight, now)
+	srv, client := nodeTestClient(t, node)
+	snap, err := takeNodeSnapshot(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snap.Network != networkMainnet || snap.BestHash != nodeTestTip || snap.Template.Height != nodeTestHeight || snap.Fees() != nodeTestFees {
+		t.Errorf("snapshot %+v, template %+v", snap, snap.Template)
+	}
+	if got := strings.Join(srv.Calls(), ","); got != "getblockchaininfo,getblocktemplate,getbestblockhash" {
+		t.Errorf("calls %s", got)
+	}
+
+	unauthenticated, err := newNodeClient(srv.URL(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := takeNodeSnapshot(unauthenticated); err == nil {
+		t.Error("snapshot without credentials succeeded")
+	}
+
+	node.Chain = "litecoin"
+	srv.SetNode(node)
+	if _, err := takeNodeSnapshot(client); err == nil || !strings.Contains(err.Error(), "unknown chain") {
+		t.Errorf("got %v, want an unknown chain error", err)
+	}
+}
+
+func TestCheckAgainstNode(t *testing.T) {
+	now := time.Now()
+	_, client := nodeTestClient(t, nodeTestNode(nodeTestTip, nodeTestHeight, now))
+	snap, err := takeNodeSnapshot(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wallet, err := generateRandomWallet(newStream(streamIdentity, t.Name()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	subsidy := blockSubsidy(&chaincfg.MainNetParams, nodeTestHeight)
+	onTip := stratumPrevHash(nodeTestTip)
+	ntime := func(d time.Duration) string { return fmt.Sprintf("%08x", now.Add(d).Unix()) }
+
+	tests := []struct {
+		name  string
+		value int64
+		job   stratumtest.Job
+		want  nodeCheck
+		issue string
+	}{
+		{"agrees", subsidy + 4000000, stratumtest.Job{PrevHash: onTip, NBits: nodeTestBits, NTime: ntime(0)}, nodeCheck{}, ""},
+		{"stale", subsidy + 4000000, stratumtest.Job{PrevHash: strings.Repeat("11", 32), NBits: "1d00ffff", NTime: ntime(0)}, nodeCheck{Stale: true}, "does not build on the local node's tip"},
+		{"bits", subsidy + 4000000, stratumtest.Job{PrevHash: onTip, NBits: "1d00ffff", NTime: ntime(0)}, nodeCheck{BitsMismatch: true}, "nbits 1d00ffff differs from the local node's " + nodeTestBits},
+		{"ntime ahead", subsidy + 4000000, stratumtest.Job{PrevHash: onTip, NBits: nodeTestBits, NTime: ntime(3 * time.Hour)}, nodeCheck{NTimeOutOfRange: true}, "outside the node's valid range"},
+		{"ntime behind", subsidy + 4000000, stratumtest.Job{PrevHash: onTip, NBits: nodeTestBits, NTime: ntime(-2 * time.Hour)}, nodeCheck{NTimeOutOfRange: true}, "outside the node's valid range"},
+		{"low fees", subsidy + 1000000, stratumtest.Job{PrevHash: onTip, NBits: nodeTestBits, NTime: ntime(0)}, nodeCheck{LowFees: true}, "template fees 0.01 BTC vs 0.05 BTC"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry := poolJob(t, wallet, nodeTestHeight, tt.value, tt.job)
+			agg := &scanAggregate{target: scanTarget{Host: entry.Host, Port: entry.Port}, latest: entry}
+			compareWithNode([]*scanAggregate{agg}, []*nodeSnapshot{snap})
+
+			check := agg.nodeCheck
+			if check == nil {
+				t.Fatal("no node check")
+			}
+			got := nodeCheck{Stale: check.Stale, BitsMismatch: check.BitsMismatch, NTimeOutOfRange: check.NTimeOutOfRange, LowFees: check.LowFees}
+			if got != tt.want {
+				t.Errorf("flags %+v, want %+v", got, tt.want)
+			}
+			if check.NodeHeight != nodeTestHeight || check.NodeFees != nodeTestFees || check.Fees != tt.value-subsidy {
+				t.Errorf("check %+v", check)
+			}
+
+			view := buildEntryView(entry, pingStats{}, pingStats{}, pingStats{}, nil, 0, 0, 0)
+			addNodeIssues(view, check)
+			var found bool
+			for _, issue := range view.Issues {
+				found = found || (tt.issue != "" && strings.Contains(issue.Message, tt.issue))
+			}
+			if tt.issue != "" && !found {
+				t.Errorf("no issue containing %q in %+v", tt.issue, view.Issues)
+			}
+		})
+	}
+}
+
+// A pool still on the tip from before the scan is not stale when the node
+// moves on during it, and is checked against the matching template.
+func TestCompareWithNodeAcrossTips(t *testing.T) {
+	now := time.Now()
+	srv, client := nodeTestClient(t, nodeTestNode(nodeTestTip, nodeTestHeight, now))
+	before, err := takeNodeSnapshot(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	next := "00000000000000000001ffffffffffffffffffffffffffffffffffffffffffff"
+	srv.SetNode(nodeTestNode(next, nodeTestHeight+1, now))
+	after, err := takeNodeSnapshot(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wallet, err := generateRandomWallet(newStream(streamIdentity, t.Name()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	subsidy := blockSubsidy(&chaincfg.MainNetParams, nodeTestHeight)
+	entry := poolJob(t, wallet, nodeTestHeight, subsidy+nodeTestFees, stratumtest.Job{PrevHash: stratumPrevHash(nodeTestTip), NBits: nodeTestBits, NTime: fmt.Sprintf("%08x", now.Unix())})
+
+	for _, snapshots := range [][]*nodeSnapshot{{before, after}, {before}} {
+		agg := &scanAggregate{latest: entry}
+		compareWithNode([]*scanAggregate{agg}, snapshots)
+		if check := agg.nodeCheck; check == nil || check.Stale || check.NodeHeight != nodeTestHeight {
+			t.Errorf("%d snapshots: check %+v, want the pre-scan template", len(snapshots), check)
+		}
+	}
+
+	agg := &scanAggregate{latest: entry}
+	compareWithNode([]*scanAggregate{agg}, []*nodeSnapshot{after})
+	if check := agg.nodeCheck; check == nil || !check.Stale || check.NodeHeight != nodeTestHeight+1 {
+		t.Errorf("check %+v, want stale against the post-scan template", check)
+	}
+}
@@ -18,12 +18,21 @@ type PoolDefinition struct {
 	Website   string         `json:"website"`
 	Type      string         `json:"type"`
 	Endpoints []PoolEndpoint `json:"endpoints"`
+	// Network names the chain every endpoint mines unless it overrides it;
+	// empty means the -network setting.
+	Network string `json:"network,omitempty"`
 }
 
 type PoolEndpoint struct {
 	Host string `json:"host"`
 	Port int    `json:"port"`
 	TLS  bool   `json:"tls"`
+	// Protocol is "sv2" for Stratum V2 endpoints; empty means Stratum V1.
+	Protocol string `json:"protocol,omitempty"`
+	// AuthorityKey pins the base58check authority key of an SV2 endpoint.
+	AuthorityKey string `json:"authority_pubkey,omitempty"`
+	// Network overrides the pool's network for this endpoint.
+	Network string `json:"network,omitempty"`
 }
 
 //go:embed pools.json
@@ -45,6 +54,27 @@ func parsePools(data []byte) (*PoolsData, error) {
 	if err := json.Unmarshal(data, &pools); err != nil {
 		return nil, fmt.Errorf("failed to parse pools.json: %w", err)
 	}
+	for i := range pools.Pools {
+		pool := &pools.Pools[i]
+		if pool.Network != "" {
+			network, err := normalizeNetwork(pool.Network)
+			if err != nil {
+				return nil, fmt.Errorf("pool %s: %w", pool.Name, err)
+			}
+			pool.Network = network
+		}
+		for j := range pool.Endpoints {
+			ep := &pool.Endpoints[j]
+			if ep.Network == "" {
+				continue
+			}
+			network, err := normalizeNetwork(ep.Network)
+			if err != nil {
+				return nil, fmt.Errorf("pool %s endpoint %s:%d: %w", pool.Name, ep.Host, ep.Port, err)
+			}
+			ep.Network = network
+		}
+	}
 	return &pools, nil
 }
 
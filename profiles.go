@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+)
+
+// profileShareTolerance is how far worker shares may drift between identities
+// before the pool is flagged.
+const profileShareTolerance percentage = 10
+
+type profileResult struct {
+	Identity minerIdentity
+	Entry    *logEntry
+}
+
+// probeProfiles scans every aggregate's endpoint once per identity so the
+// coinbases each identity receives can be compared.
+func probeProfiles(aggregates []*scanAggregate, ids []minerIdentity) {
+	if len(aggregates) == 0 || len(ids) == 0 {
+		return
+	}
+	total := len(aggregates) * len(ids)
+	progress := 0
+	fmt.Println("Probing identity profiles")
+	printProgress(progress, total)
+	for _, agg := range aggregates {
+		for _, id := range ids {
+			username, wallet := identityOnNetwork(id.Username(), id.Wallet, networkParams(agg.target.Network))
+			entry, err := collectFromPool(agg.target, id.Agent, username, wallet, id.Worker)
+			progress++
+			printProgress(progress, total)
+			if entry != nil {
+				agg.profiles = append(agg.profiles, profileResult{Identity: id, Entry: entry})
+			}
+			if err != nil && verbose {
+				log.Printf("pool %s:%d as %s: %v", agg.target.Host, agg.target.Port, id.Profile, err)
+			}
+		}
+	}
+}
+
+// compareProfiles summarizes what each identity was offered and whether the
+// pool paid them differently. It returns nil when no profiles were probed.
+func compareProfiles(results []profileResult) *profileComparison {
+	if len(results) == 0 {
+		return nil
+	}
+	cmp := &profileComparison{}
+	minShare, maxShare := percentage(math.MaxInt64), percentage(-1)
+	layouts := make(map[string][]string)
+	compared := 0
+	for _, res := range results {
+		entry := res.Entry
+		view := profileView{
+			Profile:     res.Identity.Profile,
+			Agent:       res.Identity.Agent,
+			Worker:      res.Identity.Worker,
+			AddressType: res.Identity.AddressType,
+			Wallet:      res.Identity.Wallet,
+			Connected:   entry.Connected,
+			Error:       entry.Error,
+			Outputs:     len(entry.Payouts),
+		}
+		if entry.Connected && entry.TotalPayout > 0 {
+			script := addressScript(entry.WalletAddress, networkParams(entry.Network))
+			var paid int64
+			for _, p := range entry.Payouts {
+				if paysScript(p, entry.WalletAddress, script) {
+					paid = addSats(paid, p.Amount)
+				}
+			}
+			view.HasData = true
+			view.WorkerPercent = share(paid, entry.TotalPayout)
+			view.Layout = payoutLayout(entry)
+			layouts[view.Layout] = append(layouts[view.Layout], view.Profile)
+			minShare = min(minShare, view.WorkerPercent)
+			maxShare = max(maxShare, view.WorkerPercent)
+			compared++
+		}
+		cmp.Views = append(cmp.Views, view)
+	}
+
+	if compared < 2 {
+		return cmp
+	}
+	if maxShare-minShare > profileShareTolerance {
+		cmp.Reasons = append(cmp.Reasons, fmt.Sprintf("worker share ranges from %s to %s", minShare, maxShare))
+	}
+	if len(layouts) > 1 {
+		parts := make([]string, 0, len(layouts))
+		for layout, profiles := range layouts {
+			parts = append(parts, fmt.Sprintf("%s: %s", strings.Join(profiles, ", "), layout))
+		}
+		sort.Strings(parts)
+		cmp.Reasons = append(cmp.Reasons, "output layout differs ("+strings.Join(parts, "; ")+")")
+	}
+	cmp.Differs = len(cmp.Reasons) > 0
+	return cmp
+}
+
+// payoutLayout describes the coinbase outputs independent of the identity's
+// own wallet, e.g. "worker + 1×p2pkh".
+func payoutLayout(entry *logEntry) string {
+	script := addressScript(entry.WalletAddress, networkParams(entry.Network))
+	worker := false
+	counts := make(map[string]int)
+	for _, p := range entry.Payouts {
+		if paysScript(p, entry.WalletAddress, script) {
+			worker = true
+			continue
+		}
+		counts[p.Type]++
+	}
+	var parts []string
+	if worker {
+		parts = append(parts, "worker")
+	}
+	types := make([]string, 0, len(counts))
+	for t := range counts {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	for _, t := range types {
+		parts = append(parts, fmt.Sprintf("%d×%s", counts[t], t))
+	}
+	if len(parts) == 0 {
+		return "none"
+	}
+	return strings.Join(parts, " + ")
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/hex"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+)
+
+const redactedWallet = "<wallet>"
+
+// publishedEntry is entry as saved sessions and the report show it: redacted
+// under -redact-wallet, untouched otherwise.
+func publishedEntry(entry *logEntry) *logEntry {
+	if !redactWallet {
+		return entry
+	}
+	return redactEntry(entry)
+}
+
+// redactEntry returns a copy of entry in which the wallet address, and the
+// hash or key its output script commits to, are replaced wherever a saved
+// session or the report shows them: the username, payouts, raw coinbase and
+// transcript. entry itself keeps the wallet so payouts can still be matched
+// to it.
+func redactEntry(entry *logEntry) *logEntry {
+	if entry == nil || entry.WalletAddress == "" {
+		return entry
+	}
+	replacer := walletReplacer(entry.WalletAddress, networkParams(entry.Network))
+	out := *entry
+	out.WalletAddress = redactedWallet
+	out.Username = replacer.Replace(entry.Username)
+	if entry.CoinbaseRaw != nil {
+		out.CoinbaseRaw = &coinbaseData{
+			CoinBase1: replacer.Replace(entry.CoinbaseRaw.CoinBase1),
+			CoinBase2: replacer.Replace(entry.CoinbaseRaw.CoinBase2),
+			FullHex:   replacer.Replace(entry.CoinbaseRaw.FullHex),
+		}
+	}
+	out.Payouts = make([]payout, len(entry.Payouts))
+	for i, p := range entry.Payouts {
+		p.Address = replacer.Replace(p.Address)
+		p.Script = replacer.Replace(p.Script)
+		p.Asm = replacer.Replace(p.Asm)
+		out.Payouts[i] = p
+	}
+	if entry.Transcript != nil {
+		out.Transcript = make([]transcriptLine, len(entry.Transcript))
+		for i, l := range entry.Transcript {
+			l.Line = replacer.Replace(l.Line)
+			out.Transcript[i] = l
+		}
+	}
+	return &out
+}
+
+// walletReplacer replaces wallet and, when it decodes, the hex of the hash or
+// witness program its output script carries.
+func walletReplacer(wallet string, params *chaincfg.Params) *strings.Replacer {
+	pairs := []string{wallet, redactedWallet}
+	if addr, err := btcutil.DecodeAddress(wallet, params); err == nil {
+		program := hex.EncodeToString(addr.ScriptAddress())
+		pairs = append(pairs, program, redactedWallet, strings.ToUpper(program), redactedWallet)
+	}
+	return strings.NewReplacer(pairs...)
+}
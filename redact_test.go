@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/wire"
+
+	"poolcensus/desktop/stratum/stratumtest"
+)
+
+func TestRedactWallet(t *testing.T) {
+	defer func(record, redact bool) { recordTranscripts, redactWallet = record, redact }(recordTranscripts, redactWallet)
+	recordTranscripts = true
+
+	for _, addressType := range walletAddressTypes {
+		t.Run(addressType, func(t *testing.T) {
+			wallet, err := generateWalletOn(newStream(streamIdentity, t.Name()), &chaincfg.MainNetParams, addressType)
+			if err != nil {
+				t.Fatal(err)
+			}
+			addr, err := btcutil.DecodeAddress(wallet, &chaincfg.MainNetParams)
+			if err != nil {
+				t.Fatal(err)
+			}
+			program := hex.EncodeToString(addr.ScriptAddress())
+
+			c1, c2, err := stratumtest.BuildCoinbase(925000, "/redact/", 12, []*wire.TxOut{wire.NewTxOut(testSubsidy, addressScript(wallet, &chaincfg.MainNetParams))})
+			if err != nil {
+				t.Fatal(err)
+			}
+			sc := stratumtest.DefaultScenario()
+			sc.Jobs = []stratumtest.Job{{CoinBase1: c1, CoinBase2: c2}}
+			entry, err := scanScenario(t, sc, wallet)
+			if err != nil {
+				t.Fatal(err)
+			}
+			agg := &scanAggregate{target: scanTarget{Host: entry.Host, Port: entry.Port}, latest: entry}
+
+			leaks := func(what, text string) {
+				t.Helper()
+				if strings.Contains(text, wallet) || strings.Contains(strings.ToLower(text), program) {
+					t.Errorf("%s shows the wallet", what)
+				}
+			}
+
+			redactWallet = true
+			dir := t.TempDir()
+			if err := saveSession(dir, entry, 0); err != nil {
+				t.Fatal(err)
+			}
+			saved, err := os.ReadFile(filepath.Join(dir, strings.TrimSuffix(detailsFileName(entry.Host, entry.Port), ".html")+"-pass1.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			leaks("saved session", string(saved))
+			var loaded logEntry
+			if err := json.Unmarshal(saved, &loaded); err != nil {
+				t.Fatal(err)
+			}
+			if loaded.WalletAddress != redactedWallet || !strings.HasPrefix(loaded.Username, redactedWallet+".") {
+				t.Errorf("saved wallet %q, username %q", loaded.WalletAddress, loaded.Username)
+			}
+			if len(loaded.Transcript) == 0 || len(loaded.Payouts) != 1 || loaded.Payouts[0].Amount != testSubsidy {
+				t.Errorf("saved session lost its transcript or payouts: %+v", loaded.Payouts)
+			}
+
+			view := buildDashboardView([]*scanAggregate{agg}, defaultSortBy)
+			report := filepath.Join(t.TempDir(), "report.html")
+			if err := writeDetailsPages(view, report); err != nil {
+				t.Fatal(err)
+			}
+			page, err := os.ReadFile(filepath.Join(filepath.Dir(report), detailsDir, detailsFileName(entry.Host, entry.Port)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			leaks("details page", string(page))
+
+			// The analysis still sees the wallet and credits the worker.
+			if entry.WalletAddress != wallet {
+				t.Fatal("redaction touched the scanned entry")
+			}
+			for _, e := range append(view.CleanEntries, view.IssueEntries...) {
+				if e.Host.Latest.WorkerShare != testSubsidy {
+					t.Errorf("worker share %d after redaction, want %d", e.Host.Latest.WorkerShare, testSubsidy)
+				}
+			}
+
+			redactWallet = false
+			plain, err := json.Marshal(publishedEntry(entry))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(string(plain), wallet) {
+				t.Error("entry redacted without -redact-wallet")
+			}
+		})
+	}
+}
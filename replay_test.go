@@ -0,0 +1,130 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"poolcensus/desktop/stratum"
+	"poolcensus/desktop/stratum/replay"
+)
+
+type replayExpect struct {
+	err        string
+	payouts    []string
+	worker     int64
+	issues     []string
+	severity   int
+	deviations []string
+	messages   []string
+}
+
+var replayExpectations = map[string]replayExpect{
+	"authorize_rejected": {
+		err:      "Invalid worker name (code 24)",
+		severity: severityNoPayout,
+	},
+	"fee_split_2pct": {
+		payouts: []string{
+			"p2wpkh bc1qxy2kgdygjrsqtzq2n0yrf2493p83kkfjhx0wlh 6286904",
+			"p2pkh 1BoatSLRHtKNngkdXEeobR76b53LETtpyT 308058306",
+		},
+		worker: 308058306,
+	},
+	"fee_split_5pct": {
+		payouts: []string{
+			"p2pkh 1BoatSLRHtKNngkdXEeobR76b53LETtpyT 298627950",
+			"p2wpkh bc1qxy2kgdygjrsqtzq2n0yrf2493p83kkfjhx0wlh 15717260",
+		},
+		worker: 298627950,
+		issues: []string{
+			fmt.Sprintf("%d worker share 95%% below 98%%", severityLowShare),
+		},
+		severity: severityLowShare,
+	},
+	"pool_wallet_only": {
+		payouts: []string{"p2wpkh bc1qxy2kgdygjrsqtzq2n0yrf2493p83kkfjhx0wlh 314345210"},
+		issues: []string{
+			fmt.Sprintf("%d SINGLE PAYOUT MISSING WORKER WALLET", severitySingleMissingWallet),
+		},
+		severity: severitySingleMissingWallet,
+	},
+	"protocol_noise": {
+		payouts: []string{"p2pkh 1BoatSLRHtKNngkdXEeobR76b53LETtpyT 314345210"},
+		worker:  314345210,
+		deviations: []string{
+			stratum.DeviationInvalidJSON,
+			stratum.DeviationUnknownMethod,
+			stratum.DeviationUnexpectedResponse,
+		},
+		messages: []string{"Pool fee changes to 1.5% on Monday"},
+	},
+	"solo_full_payout": {
+		payouts: []string{"p2pkh 1BoatSLRHtKNngkdXEeobR76b53LETtpyT 314345210"},
+		worker:  314345210,
+	},
+}
+
+func TestCannedSessions(t *testing.T) {
+	for _, name := range replay.CannedNames() {
+		t.Run(name, func(t *testing.T) {
+			want, ok := replayExpectations[name]
+			if !ok {
+				t.Fatalf("no expectations for canned session %s", name)
+			}
+			session, err := replay.Canned(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			srv, err := replay.NewServer(session, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() {
+				srv.Close()
+				if errs := srv.Errors(); len(errs) > 0 {
+					t.Errorf("client diverged from the recording: %v", errors.Join(errs...))
+				}
+			}()
+
+			target := scanTarget{Host: srv.Host(), Port: srv.Port()}
+			entry, err := collectFromPool(target, session.UserAgent, session.Username, session.WalletAddress, session.WorkerName)
+			if want.err == "" && err != nil {
+				t.Fatal(err)
+			}
+			if want.err != "" && (err == nil || !strings.Contains(err.Error(), want.err)) {
+				t.Fatalf("got %v, want error containing %q", err, want.err)
+			}
+
+			var payouts []string
+			for _, p := range entry.Payouts {
+				payouts = append(payouts, fmt.Sprintf("%s %s %d", p.Type, p.Address, p.Amount))
+			}
+			assertStrings(t, "payouts", payouts, want.payouts)
+
+			view := buildEntryView(entry, pingStats{}, pingStats{}, pingStats{}, nil, 0, 0, 0)
+			if view.WorkerShare != want.worker {
+				t.Errorf("worker share %d, want %d", view.WorkerShare, want.worker)
+			}
+			var issues []string
+			for _, issue := range view.Issues {
+				issues = append(issues, fmt.Sprintf("%d %s", issue.Score, issue.Message))
+			}
+			assertStrings(t, "issues", issues, want.issues)
+			if view.IssueSeverity != want.severity {
+				t.Errorf("severity %d, want %d", view.IssueSeverity, want.severity)
+			}
+
+			assertStrings(t, "deviations", deviationKindsOf(entry), want.deviations)
+			assertStrings(t, "messages", entry.ServerMessages, want.messages)
+		})
+	}
+}
+
+func assertStrings(t *testing.T, what string, got, want []string) {
+	t.Helper()
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("%s:\n got %q\nwant %q", what, got, want)
+	}
+}
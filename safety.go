@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math/rand"
+	"strings"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/wire"
+)
+
+const (
+	safetyBadChecksum = "checksum-broken address"
+	safetyNotAddress  = "non-address username"
+)
+
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+// safetyCheck records whether a pool authorized a username no valid payout on
+// the pool's network could be made to, and what its coinbase paid instead.
+type safetyCheck struct {
+	Kind      string
+	Wallet    string
+	Authorize string
+	Error     string
+	Payouts   string
+}
+
+type safetyProbe struct {
+	Kind   string
+	Wallet string
+}
+
+// newSafetyProbes builds one username per kind of garbage a careless pool on
+// params' network might accept, drawing from r.
+func newSafetyProbes(r *rand.Rand, params *chaincfg.Params) ([]safetyProbe, error) {
+	valid, err := generateWalletOn(r, params, addressP2PKH)
+	if err != nil {
+		return nil, err
+	}
+	wrongParams := &chaincfg.TestNet3Params
+	if params.Net != wire.MainNet {
+		wrongParams = &chaincfg.MainNetParams
+	}
+	wrong, err := generateWalletOn(r, wrongParams, addressP2WPKH)
+	if err != nil {
+		return nil, err
+	}
+	return []safetyProbe{
+		{Kind: safetyBadChecksum, Wallet: breakChecksum(valid)},
+		{Kind: wrongParams.Name + " address", Wallet: wrong},
+		{Kind: safetyNotAddress, Wallet: fmt.Sprintf("miner%06d", r.Intn(1000000))},
+	}, nil
+}
+
+// breakChecksum swaps the last character of a base58 address for another
+// valid one, so only the checksum fails.
+func breakChecksum(addr string) string {
+	last := addr[len(addr)-1]
+	i := strings.IndexByte(base58Alphabet, last)
+	return addr[:len(addr)-1] + string(base58Alphabet[(i+1)%len(base58Alphabet)])
+}
+
+// probeSafety authorizes with every safety probe at each aggregate's endpoint.
+// Each endpoint's probes come from its own stream, so they do not depend on
+// which other pools answered the scan.
+func probeSafety(aggregates []*scanAggregate, agent, worker string) error {
+	if len(aggregates) == 0 {
+		return nil
+	}
+	probes := make([][]safetyProbe, len(aggregates))
+	total := 0
+	for i, agg := range aggregates {
+		p, err := newSafetyProbes(newStream(streamSafety, fmt.Sprintf("%s:%d", agg.target.Host, agg.target.Port)), networkParams(agg.target.Network))
+		if err != nil {
+			return err
+		}
+		probes[i] = p
+		total += len(p)
+	}
+	progress := 0
+	fmt.Println("Probing invalid payout addresses")
+	printProgress(progress, total)
+	for i, agg := range aggregates {
+		for _, probe := range probes[i] {
+			entry, err := collectFromPool(agg.target, agent, probe.Wallet+"."+worker, probe.Wallet, worker)
+			progress++
+			printProgress(progress, total)
+			check := safetyCheck{Kind: probe.Kind, Wallet: probe.Wallet, Authorize: authorizeOutcome(entry, err)}
+			if err != nil {
+				check.Error = err.Error()
+			}
+			if entry != nil && len(entry.Payouts) > 0 {
+				check.Payouts = payoutSummary(entry)
+			}
+			agg.safetyChecks = append(agg.safetyChecks, check)
+			if err != nil && verbose {
+				log.Printf("pool %s:%d with %s: %v", agg.target.Host, agg.target.Port, probe.Kind, err)
+			}
+		}
+	}
+	return nil
+}
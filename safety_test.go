@@ -0,0 +1,30 @@
+package main
+
+import "testing"
+
+func TestAddSafetyIssue(t *testing.T) {
+	accepted := []safetyCheck{{Kind: safetyNotAddress, Authorize: authorizeAccepted}}
+	rejected := []safetyCheck{{Kind: safetyNotAddress, Authorize: authorizeRejected}}
+	tests := []struct {
+		name        string
+		workerShare int64
+		checks      []safetyCheck
+		severity    int
+	}{
+		{"solo pool accepts", testSubsidy, accepted, severityAcceptsGarbage},
+		{"solo pool rejects", testSubsidy, rejected, 0},
+		{"account pool accepts", 0, accepted, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			view := &entryView{WorkerShare: tt.workerShare}
+			addSafetyIssue(view, tt.checks)
+			if view.IssueSeverity != tt.severity || (tt.severity == 0) != (len(view.Issues) == 0) {
+				t.Errorf("severity %d issues %+v, want severity %d", view.IssueSeverity, view.Issues, tt.severity)
+			}
+			if len(view.SafetyChecks) != len(tt.checks) {
+				t.Errorf("checks %+v not kept for the details page", view.SafetyChecks)
+			}
+		})
+	}
+}
@@ -1,9 +1,15 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
+	"os"
+	"path/filepath"
 	"sort"
 	"strings"
 	"time"
@@ -12,10 +18,13 @@ import (
 )
 
 type scanTarget struct {
-	PoolName string
-	Host     string
-	Port     int
-	TLS      bool
+	PoolName     string
+	Host         string
+	Port         int
+	TLS          bool
+	Protocol     string
+	AuthorityKey string
+	Network      string
 }
 
 type scanAggregate struct {
@@ -26,8 +35,29 @@ type scanAggregate struct {
 	attempts   int
 	errorCount int
 	errors     []error
+	deviations []protocolDeviation
+	profiles   []profileResult
+
+	addressChecks []addressCheck
+	safetyChecks  []safetyCheck
+	feeRank       *feeRank
+	tipCheck      *tipCheck
+	nodeCheck     *nodeCheck
 }
 
+const (
+	rpcTimeout     = 20 * time.Second
+	jobWaitTimeout = 30 * time.Second
+)
+
+// poolTLSConfig overrides the TLS settings for pool connections; nil uses the
+// system roots. Integration tests point it at a stratumtest certificate.
+var poolTLSConfig *tls.Config
+
+// poolLimits caps what a single stratum session may send before it is aborted
+// as hostile; set from the -max-* flags.
+var poolLimits = stratum.DefaultLimits()
+
 func collectTargets(pools *PoolsData, filter string) []scanTarget {
 	var targets []scanTarget
 	for _, pool := range filterPools(pools, filter) {
@@ -36,10 +66,13 @@ func collectTargets(pools *PoolsData, filter string) []scanTarget {
 				continue
 			}
 			targets = append(targets, scanTarget{
-				PoolName: pool.Name,
-				Host:     ep.Host,
-				Port:     ep.Port,
-				TLS:      ep.TLS,
+				PoolName:     pool.Name,
+				Host:         ep.Host,
+				Port:         ep.Port,
+				TLS:          ep.TLS,
+				Protocol:     ep.Protocol,
+				AuthorityKey: ep.AuthorityKey,
+				Network:      firstNonEmpty(ep.Network, pool.Network, runNetwork),
 			})
 		}
 	}
@@ -58,7 +91,8 @@ func scanTargets(targets []scanTarget, agent, username, wallet, worker string, p
 
 	for pass := 0; pass < passes; pass++ {
 		for _, target := range targets {
-			entry, err := collectFromPool(target, agent, username, wallet, worker)
+			targetUser, targetWallet := identityOnNetwork(username, wallet, networkParams(target.Network))
+			entry, err := collectFromPool(target, agent, targetUser, targetWallet, worker)
 			progress++
 			printProgress(progress, total)
 
@@ -70,10 +104,17 @@ func scanTargets(targets []scanTarget, agent, username, wallet, worker string, p
 			}
 			agg.attempts++
 
+			if entry != nil && sessionDir != "" {
+				if err := saveSession(sessionDir, entry, pass); err != nil {
+					logVerbose("failed to save session for %s:%d: %v", target.Host, target.Port, err)
+				}
+			}
+
 			if entry != nil {
 				agg.latest = entry
 				agg.pingStats.Add(entry.PingMs)
 				agg.jobStats.AddBounded(entry.JobLatencyMs, timeoutJobWaitMs)
+				agg.deviations = append(agg.deviations, entry.Deviations...)
 				if !entry.Connected {
 					agg.errorCount++
 					agg.errors = append(agg.errors, fmt.Errorf("%s:%d: %s", target.Host, target.Port, entry.Error))
@@ -102,89 +143,147 @@ func scanTargets(targets []scanTarget, agent, username, wallet, worker string, p
 }
 
 func collectFromPool(target scanTarget, agent, username, wallet, worker string) (*logEntry, error) {
-	client := stratum.NewClient(target.Host, target.Port, username, "x", target.TLS)
+	if target.Protocol == protocolSV2 {
+		return collectFromSV2Pool(target, agent, username, wallet, worker)
+	}
+
+	opts := []stratum.Option{stratum.WithLimits(poolLimits)}
+	if poolTLSConfig != nil {
+		opts = append(opts, stratum.WithTLSConfig(poolTLSConfig))
+	}
+	var transcript *stratum.Transcript
+	if recordTranscripts {
+		transcript = stratum.NewTranscript()
+		opts = append(opts, stratum.WithTranscript(transcript))
+	}
+	client := stratum.NewClient(target.Host, target.Port, username, "x", target.TLS, opts...)
 	defer client.Close()
 
 	var (
-		done         = make(chan struct{}, 1)
-		disconnect   = make(chan error, 1)
-		jobLatency   float64
-		pingMs       float64
-		currentDiff  float64
-		jobWaitStart time.Time
-		captured     *logEntry
+		messages    []string
+		currentDiff float64
 	)
 
-	client.OnDisconnect = func(err error) {
-		select {
-		case disconnect <- err:
-		default:
+	// handle applies one event; it reports a disconnect through err.
+	handle := func(ev stratum.Event) (notify *stratum.NotifyEvent, err error) {
+		switch ev := ev.(type) {
+		case stratum.DifficultyEvent:
+			currentDiff = ev.Difficulty
+		case stratum.MessageEvent:
+			logVerbose("message from %s:%d: %s", target.Host, target.Port, ev.Message)
+			messages = append(messages, ev.Message)
+		case stratum.NotifyEvent:
+			return &ev, nil
+		case stratum.DisconnectEvent:
+			if ev.Err == nil {
+				return nil, stratum.ErrConnectionClosed
+			}
+			return nil, ev.Err
 		}
+		return nil, nil
 	}
 
-	client.OnNotify = func(params *stratum.NotifyParams) {
-		if captured != nil {
-			return
-		}
-		if !jobWaitStart.IsZero() {
-			jobLatency = time.Since(jobWaitStart).Seconds() * 1000.0
-		}
-		info, err := stratum.DecodeCoinbaseParts(
-			params.CoinBase1,
-			params.CoinBase2,
-			client.ExtraNonce1(),
-			client.ExtraNonce2Size(),
-		)
-		if err != nil {
-			logVerbose("failed to decode coinbase for %s:%d: %v", target.Host, target.Port, err)
+	// drain applies events already delivered, so error entries still carry
+	// any messages the pool sent before failing.
+	drain := func() {
+		for {
+			select {
+			case ev, ok := <-client.Events():
+				if !ok {
+					return
+				}
+				_, _ = handle(ev)
+			default:
+				return
+			}
 		}
+	}
 
-		captured = buildJobEntry(target, params, client, agent, username, wallet, worker, currentDiff, pingMs, jobLatency, info)
-		select {
-		case done <- struct{}{}:
-		default:
+	withSession := func(entry *logEntry) *logEntry {
+		if len(messages) > 0 {
+			entry.ServerMessages = append([]string(nil), messages...)
+		}
+		for _, dev := range client.Deviations() {
+			entry.Deviations = append(entry.Deviations, protocolDeviation{Kind: dev.Kind, Detail: dev.Detail})
 		}
+		entry.Transcript = buildTranscript(transcript)
+		return entry
 	}
 
-	client.OnDifficulty = func(diff float64) {
-		currentDiff = diff
+	fail := func(err error, connected bool) (*logEntry, error) {
+		drain()
+		return withSession(buildErrorEntryWithConnected(target, agent, username, wallet, worker, err, connected)), err
 	}
 
-	if err := client.Connect(); err != nil {
-		return buildErrorEntry(target, agent, username, wallet, worker, err), err
+	ctx := context.Background()
+	if err := client.Connect(ctx); err != nil {
+		return fail(err, false)
 	}
 
 	start := time.Now()
-	if err := client.Subscribe(agent); err != nil {
-		return buildErrorEntry(target, agent, username, wallet, worker, err), err
+	subscribeCtx, cancel := context.WithTimeout(ctx, rpcTimeout)
+	err := client.Subscribe(subscribeCtx, agent)
+	cancel()
+	if err != nil {
+		return fail(err, false)
 	}
-	pingMs = time.Since(start).Seconds() * 1000.0
+	pingMs := time.Since(start).Seconds() * 1000.0
 
-	jobWaitStart = time.Now()
-	if err := client.Authorize(); err != nil {
-		return buildErrorEntry(target, agent, username, wallet, worker, err), err
+	jobWaitStart := time.Now()
+	authorizeCtx, cancel := context.WithTimeout(ctx, rpcTimeout)
+	err = client.Authorize(authorizeCtx)
+	cancel()
+	if err != nil {
+		return fail(err, false)
 	}
 
-	select {
-	case <-done:
-		return captured, nil
-	case err := <-disconnect:
-		if err == nil {
-			err = errors.New("connection closed")
+	timeout := time.NewTimer(jobWaitTimeout)
+	defer timeout.Stop()
+	for {
+		select {
+		case ev, ok := <-client.Events():
+			if !ok {
+				return fail(stratum.ErrConnectionClosed, false)
+			}
+			notify, err := handle(ev)
+			if err != nil {
+				return fail(err, false)
+			}
+			if notify == nil {
+				continue
+			}
+			jobLatency := 0.0
+			if notify.Received.After(jobWaitStart) {
+				jobLatency = notify.Received.Sub(jobWaitStart).Seconds() * 1000.0
+			}
+			info, err := stratum.DecodeCoinbasePartsWith(
+				decodeOptions(target),
+				notify.Params.CoinBase1,
+				notify.Params.CoinBase2,
+				notify.ExtraNonce1,
+				notify.ExtraNonce2Size,
+			)
+			if err != nil {
+				logVerbose("failed to decode coinbase for %s:%d: %v", target.Host, target.Port, err)
+			}
+			entry := buildJobEntry(target, notify.Params, notify.ExtraNonce1, notify.ExtraNonce2Size, agent, username, wallet, worker, currentDiff, pingMs, jobLatency, info)
+			return withSession(entry), nil
+		case <-timeout.C:
+			return fail(errors.New("timeout waiting for job"), true)
 		}
-		return buildErrorEntry(target, agent, username, wallet, worker, err), err
-	case <-time.After(30 * time.Second):
-		err := fmt.Errorf("timeout waiting for job")
-		return buildErrorEntryWithConnected(target, agent, username, wallet, worker, err, true), err
 	}
 }
 
+func decodeOptions(target scanTarget) stratum.DecodeOptions {
+	return stratum.DecodeOptions{Params: networkParams(target.Network), Rand: extranonceRand}
+}
+
 func buildErrorEntry(target scanTarget, agent, username, wallet, worker string, err error) *logEntry {
 	return buildErrorEntryWithConnected(target, agent, username, wallet, worker, err, false)
 }
 
 func buildErrorEntryWithConnected(target scanTarget, agent, username, wallet, worker string, err error, connected bool) *logEntry {
-	return &logEntry{
+	entry := &logEntry{
 		Timestamp:     time.Now().UTC().Format(time.RFC3339),
 		Host:          target.Host,
 		Port:          target.Port,
@@ -196,24 +295,37 @@ func buildErrorEntryWithConnected(target scanTarget, agent, username, wallet, wo
 		WorkerName:    worker,
 		Password:      "x",
 		TLS:           target.TLS,
+		Protocol:      target.Protocol,
+		Network:       target.Network,
 	}
+	var limitErr *stratum.LimitError
+	if errors.As(err, &limitErr) {
+		entry.Abuse = limitErr.Limit
+	}
+	return entry
 }
 
-func buildJobEntry(target scanTarget, params *stratum.NotifyParams, client *stratum.Client, agent, username, wallet, worker string, difficulty, pingMs, jobLatency float64, info *stratum.CoinbaseInfo) *logEntry {
-	var totalPayout float64
+func buildJobEntry(target scanTarget, params *stratum.NotifyParams, extraNonce1 string, extraNonce2Size int, agent, username, wallet, worker string, difficulty, pingMs, jobLatency float64, info *stratum.CoinbaseInfo) *logEntry {
+	var totalPayout int64
 	var payoutList []payout
 	if info != nil {
 		for i, output := range info.Outputs {
-			if output.ScriptType == "witness_commitment" || output.ScriptType == "OP_RETURN" {
+			// Data outputs are not payouts unless they burn value.
+			if output.ScriptType == stratum.ScriptWitnessCommitment || (output.ScriptType == stratum.ScriptOpReturn && output.Value == 0) {
 				continue
 			}
 			payoutList = append(payoutList, payout{
-				OutputIndex: i,
-				Address:     output.Address,
-				Amount:      output.ValueBTC,
-				Type:        output.ScriptType,
+				OutputIndex:  i,
+				Address:      output.Address,
+				Amount:       output.Value,
+				Type:         output.ScriptType,
+				Script:       hex.EncodeToString(output.PkScript),
+				PubKeys:      output.PubKeys,
+				RequiredSigs: output.RequiredSigs,
+				Asm:          output.Asm,
+				Unspendable:  output.Unspendable,
 			})
-			totalPayout += output.ValueBTC
+			totalPayout = addSats(totalPayout, output.Value)
 		}
 	}
 
@@ -228,7 +340,7 @@ func buildJobEntry(target scanTarget, params *stratum.NotifyParams, client *stra
 	if info != nil {
 		fullCoinbase, _ = stratum.BuildFullCoinbase(
 			params.CoinBase1,
-			client.ExtraNonce1(),
+			extraNonce1,
 			info.ExtraNonce2,
 			params.CoinBase2,
 		)
@@ -236,7 +348,7 @@ func buildJobEntry(target scanTarget, params *stratum.NotifyParams, client *stra
 
 	poolTag := target.PoolName
 	if poolTag == "" {
-		poolTag = extractPoolTag(params.CoinBase2)
+		poolTag = firstNonEmpty(extractPoolTag(params.CoinBase2), extractPoolTag(params.CoinBase1))
 	}
 
 	return &logEntry{
@@ -249,14 +361,19 @@ func buildJobEntry(target scanTarget, params *stratum.NotifyParams, client *stra
 		WalletAddress:   wallet,
 		WorkerName:      worker,
 		Password:        "x",
-		ExtraNonce1:     client.ExtraNonce1(),
-		ExtraNonce2Size: client.ExtraNonce2Size(),
+		ExtraNonce1:     extraNonce1,
+		ExtraNonce2Size: extraNonce2Size,
 		Difficulty:      difficulty,
 		PingMs:          pingMs,
 		JobLatencyMs:    jobLatency,
 		BlockHeight:     blockHeight,
+		PrevHash:        params.PrevHash,
+		NBits:           params.NBits,
+		NTime:           params.NTime,
 		PoolTag:         poolTag,
 		TLS:             target.TLS,
+		Protocol:        target.Protocol,
+		Network:         target.Network,
 		CoinbaseRaw: &coinbaseData{
 			CoinBase1: params.CoinBase1,
 			CoinBase2: params.CoinBase2,
@@ -264,7 +381,96 @@ func buildJobEntry(target scanTarget, params *stratum.NotifyParams, client *stra
 		},
 		Payouts:     payoutList,
 		TotalPayout: totalPayout,
+		ScriptSig:   buildScriptSigData(info),
+		Commitments: buildCommitments(info),
+		Lint:        buildLint(info),
+		Header:      validateHeader(params, fullCoinbase, networkParams(target.Network), blockHeight, time.Now()),
+	}
+}
+
+func buildScriptSigData(info *stratum.CoinbaseInfo) *scriptSigData {
+	if info == nil || info.ScriptSigLayout == nil {
+		return nil
+	}
+	layout := info.ScriptSigLayout
+	data := &scriptSigData{
+		Length:      layout.Length,
+		Height:      layout.Height,
+		HasHeight:   layout.HasHeight,
+		Prefix:      hex.EncodeToString(layout.Prefix),
+		ExtraNonce1: hex.EncodeToString(layout.ExtraNonce1),
+		ExtraNonce2: hex.EncodeToString(layout.ExtraNonce2),
+		Suffix:      hex.EncodeToString(layout.Suffix),
+		Violations:  layout.Violations,
+	}
+	for _, push := range layout.Pushes {
+		data.Pushes = append(data.Pushes, scriptSigPush{
+			Offset: push.Offset,
+			Opcode: push.Opcode,
+			Data:   hex.EncodeToString(push.Data),
+			Text:   printableText(push.Data),
+			Role:   push.Role,
+		})
+	}
+	for _, tag := range layout.Tags {
+		data.Tags = append(data.Tags, scriptSigTag{Source: tag.Source, Field: tag.Field, Text: tag.Text})
+	}
+	return data
+}
+
+func buildLint(info *stratum.CoinbaseInfo) []lintFinding {
+	if info == nil {
+		return nil
+	}
+	var out []lintFinding
+	for _, f := range info.Lint {
+		out = append(out, lintFinding{Rule: f.Rule, Severity: f.Severity, Message: f.Message})
+	}
+	return out
+}
+
+// printableText returns b as text when every byte is printable ASCII.
+func printableText(b []byte) string {
+	if len(b) == 0 {
+		return ""
+	}
+	for _, c := range b {
+		if c < 0x20 || c > 0x7e {
+			return ""
+		}
+	}
+	return string(b)
+}
+
+func buildTranscript(t *stratum.Transcript) []transcriptLine {
+	lines := t.Lines()
+	if len(lines) == 0 {
+		return nil
+	}
+	out := make([]transcriptLine, 0, len(lines))
+	for _, l := range lines {
+		out = append(out, transcriptLine{
+			OffsetMs:  l.Offset.Seconds() * 1000.0,
+			Direction: l.Direction,
+			Line:      l.Line,
+		})
+	}
+	return out
+}
+
+// saveSession writes entry as JSON; files with a transcript can be loaded by
+// the replay package.
+func saveSession(dir string, entry *logEntry, pass int) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	entry = publishedEntry(entry)
+	data, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return err
 	}
+	name := strings.TrimSuffix(detailsFileName(entry.Host, entry.Port), ".html")
+	return os.WriteFile(filepath.Join(dir, fmt.Sprintf("%s-pass%d.json", name, pass+1)), append(data, '\n'), 0o644)
 }
 
 func printProgress(current, total int) {
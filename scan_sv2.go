@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+
+	"poolcensus/desktop/stratum"
+	sv2 "poolcensus/desktop/stratum/v2"
+)
+
+const protocolSV2 = "sv2"
+
+// sv2MinExtranonceSize is the extranonce space requested on extended
+// channels; it only has to be large enough for the coinbase to decode.
+const sv2MinExtranonceSize = 4
+
+var errStandardChannelOnly = errors.New("pool only offers standard channels; coinbase not disclosed")
+
+func collectFromSV2Pool(target scanTarget, agent, username, wallet, worker string) (*logEntry, error) {
+	var authority *btcec.PublicKey
+	if target.AuthorityKey != "" {
+		key, err := sv2.ParseAuthorityKey(target.AuthorityKey)
+		if err != nil {
+			return buildErrorEntry(target, agent, username, wallet, worker, err), err
+		}
+		authority = key
+	}
+
+	client := sv2.NewClient(target.Host, target.Port, authority, sv2.WithLimits(poolLimits))
+	defer client.Close()
+
+	if err := client.Connect(); err != nil {
+		return buildErrorEntry(target, agent, username, wallet, worker, err), err
+	}
+
+	vendor, firmware := splitAgent(agent)
+	start := time.Now()
+	if _, err := client.SetupConnection(vendor, "", firmware, 0); err != nil {
+		return buildErrorEntry(target, agent, username, wallet, worker, err), err
+	}
+	pingMs := time.Since(start).Seconds() * 1000.0
+
+	jobWaitStart := time.Now()
+	channel, err := client.OpenExtendedChannel(username, sv2MinExtranonceSize)
+	if err != nil {
+		logVerbose("extended channel refused by %s:%d: %v", target.Host, target.Port, err)
+		channel, err = client.OpenStandardChannel(username)
+		if err != nil {
+			return buildErrorEntry(target, agent, username, wallet, worker, err), err
+		}
+	}
+
+	job, err := client.WaitJob(channel, 30*time.Second)
+	if err != nil {
+		return buildErrorEntryWithConnected(target, agent, username, wallet, worker, err, true), err
+	}
+	jobLatency := time.Since(jobWaitStart).Seconds() * 1000.0
+
+	session := buildSV2Session(client.Certificate(), channel, job)
+	if job.Extended == nil {
+		entry := buildErrorEntryWithConnected(target, agent, username, wallet, worker, errStandardChannelOnly, true)
+		entry.PingMs = pingMs
+		entry.JobLatencyMs = jobLatency
+		entry.Difficulty = targetDifficulty(channel.Target)
+		entry.SV2 = session
+		return entry, nil
+	}
+
+	params := &stratum.NotifyParams{
+		PrevHash:  session.PrevHash,
+		CoinBase1: hex.EncodeToString(job.Extended.CoinbaseTxPrefix),
+		CoinBase2: hex.EncodeToString(job.Extended.CoinbaseTxSuffix),
+	}
+	params.Version = fmt.Sprintf("%08x", job.Extended.Version)
+	for _, step := range job.Extended.MerklePath {
+		params.MerkleBranch = append(params.MerkleBranch, hex.EncodeToString(step[:]))
+	}
+	if job.PrevHash != nil {
+		params.NBits = fmt.Sprintf("%08x", job.PrevHash.NBits)
+		params.NTime = fmt.Sprintf("%08x", job.PrevHash.MinNTime)
+	}
+	extraNonce1 := hex.EncodeToString(channel.ExtranoncePrefix)
+	info, err := stratum.DecodeCoinbasePartsWith(decodeOptions(target), params.CoinBase1, params.CoinBase2, extraNonce1, channel.ExtranonceSize)
+	if err != nil {
+		logVerbose("failed to decode coinbase for %s:%d: %v", target.Host, target.Port, err)
+	}
+
+	entry := buildJobEntry(target, params, extraNonce1, channel.ExtranonceSize, agent, username, wallet, worker, targetDifficulty(channel.Target), pingMs, jobLatency, info)
+	entry.SV2 = session
+	return entry, nil
+}
+
+func buildSV2Session(cert *sv2.Certificate, channel *sv2.Channel, job *sv2.Job) *sv2Session {
+	session := &sv2Session{Channel: "standard"}
+	if channel.Extended {
+		session.Channel = "extended"
+	}
+	if cert != nil {
+		session.ServerKey = hex.EncodeToString(cert.ServerKey[:])
+		session.CertificateVerified = cert.Verified
+		session.CertificateExpires = time.Unix(int64(cert.NotValidAfter), 0).UTC().Format(time.RFC3339)
+	}
+	switch {
+	case job.Extended != nil:
+		session.Version = job.Extended.Version
+	case job.Standard != nil:
+		session.Version = job.Standard.Version
+		session.MerkleRoot = hex.EncodeToString(job.Standard.MerkleRoot)
+	}
+	if job.PrevHash != nil {
+		session.PrevHash = hex.EncodeToString(reverseBytes(job.PrevHash.PrevHash[:]))
+	}
+	return session
+}
+
+// splitAgent turns "cgminer/4.10.0" into the vendor and firmware fields of
+// SetupConnection.
+func splitAgent(agent string) (string, string) {
+	vendor, firmware, _ := strings.Cut(agent, "/")
+	return vendor, firmware
+}
+
+// targetDifficulty converts a little-endian U256 target to pool difficulty.
+func targetDifficulty(target [32]byte) float64 {
+	t := new(big.Int).SetBytes(reverseBytes(target[:]))
+	if t.Sign() == 0 {
+		return 0
+	}
+	diff1 := new(big.Int).Lsh(big.NewInt(0xffff), 208)
+	ratio := new(big.Float).Quo(new(big.Float).SetInt(diff1), new(big.Float).SetInt(t))
+	f, _ := ratio.Float64()
+	return f
+}
+
+func reverseBytes(b []byte) []byte {
+	out := make([]byte, len(b))
+	for i := range b {
+		out[len(b)-1-i] = b[i]
+	}
+	return out
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+
+	"poolcensus/desktop/stratum"
+	"poolcensus/desktop/stratum/stratumtest"
+)
+
+const testSubsidy = 312500000
+
+// testWallet returns a fresh mainnet wallet and a job whose coinbase pays the
+// whole subsidy to it.
+func testWallet(t *testing.T) (string, stratumtest.Job) {
+	t.Helper()
+	wallet, err := generateRandomWallet(newStream(streamIdentity, t.Name()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr, err := btcutil.DecodeAddress(wallet, &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkScript, err := txscript.PayToAddrScript(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c1, c2, err := stratumtest.BuildCoinbase(925000, "/stratumtest/", 12, []*wire.TxOut{wire.NewTxOut(testSubsidy, pkScript)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return wallet, stratumtest.Job{CoinBase1: c1, CoinBase2: c2}
+}
+
+// scanScenario runs collectFromPool against a stratumtest pool playing sc.
+func scanScenario(t *testing.T, sc stratumtest.Scenario, wallet string) (*logEntry, error) {
+	t.Helper()
+	srv, err := stratumtest.NewServer(sc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	target := scanTarget{Host: srv.Host(), Port: srv.Port()}
+	return collectFromPool(target, "cgminer/4.10.0", wallet+".rig", wallet, "rig")
+}
+
+func deviationKindsOf(entry *logEntry) []string {
+	var kinds []string
+	for _, d := range entry.Deviations {
+		kinds = append(kinds, d.Kind)
+	}
+	return kinds
+}
+
+func assertPaysWallet(t *testing.T, entry *logEntry, wallet string) {
+	t.Helper()
+	if !entry.Connected || entry.Error != "" {
+		t.Fatalf("entry not connected: %q", entry.Error)
+	}
+	if len(entry.Payouts) != 1 || entry.Payouts[0].Address != wallet || entry.Payouts[0].Amount != testSubsidy {
+		t.Fatalf("payouts %+v, want %d sats to %s", entry.Payouts, testSubsidy, wallet)
+	}
+	if entry.TotalPayout != testSubsidy || entry.BlockHeight != 925000 {
+		t.Errorf("total %d at height %d", entry.TotalPayout, entry.BlockHeight)
+	}
+}
+
+func TestCollectFromPoolScenarios(t *testing.T) {
+	wallet, job := testWallet(t)
+
+	tests := []struct {
+		name   string
+		modify func(*stratumtest.Scenario)
+		check  func(t *testing.T, entry *logEntry, err error)
+	}{
+		{"default", func(sc *stratumtest.Scenario) {
+			sc.Messages = []string{"welcome"}
+		}, func(t *testing.T, entry *logEntry, err error) {
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertPaysWallet(t, entry, wallet)
+			if entry.ExtraNonce1 != "f000000f" || entry.ExtraNonce2Size != 8 || entry.Difficulty != 1024 {
+				t.Errorf("extranonce %s/%d difficulty %v", entry.ExtraNonce1, entry.ExtraNonce2Size, entry.Difficulty)
+			}
+			if len(entry.ServerMessages) != 1 || entry.ServerMessages[0] != "welcome" {
+				t.Errorf("messages %q", entry.ServerMessages)
+			}
+			if len(entry.Deviations) != 0 || entry.Abuse != "" {
+				t.Errorf("deviations %v, abuse %q", entry.Deviations, entry.Abuse)
+			}
+		}},
+		{"subscribe delay", func(sc *stratumtest.Scenario) {
+			sc.SubscribeDelay = 200 * time.Millisecond
+		}, func(t *testing.T, entry *logEntry, err error) {
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertPaysWallet(t, entry, wallet)
+			if entry.PingMs < 200 {
+				t.Errorf("ping %.1f ms, want at least the 200 ms delay", entry.PingMs)
+			}
+		}},
+		{"garbage lines", func(sc *stratumtest.Scenario) {
+			sc.GarbageLines = []string{"not json", `{"id":99,"result":true,"error":null}`}
+		}, func(t *testing.T, entry *logEntry, err error) {
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertPaysWallet(t, entry, wallet)
+			want := stratum.DeviationInvalidJSON + "," + stratum.DeviationUnexpectedResponse
+			if got := strings.Join(deviationKindsOf(entry), ","); got != want {
+				t.Errorf("deviations %q, want %q", got, want)
+			}
+		}},
+		{"reject authorize", func(sc *stratumtest.Scenario) {
+			sc.RejectAuthorize = true
+		}, func(t *testing.T, entry *logEntry, err error) {
+			var rpcErr *stratum.RPCError
+			if !errors.As(err, &rpcErr) || rpcErr.Code != 24 {
+				t.Fatalf("got %v, want the pool's RPC error", err)
+			}
+			if entry.Connected || !strings.Contains(entry.Error, "Unauthorized worker") || entry.Abuse != "" {
+				t.Errorf("entry connected=%v error=%q abuse=%q", entry.Connected, entry.Error, entry.Abuse)
+			}
+		}},
+		{"notify before authorize", func(sc *stratumtest.Scenario) {
+			sc.NotifyBeforeAuthorize = true
+		}, func(t *testing.T, entry *logEntry, err error) {
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertPaysWallet(t, entry, wallet)
+		}},
+		{"set extranonce", func(sc *stratumtest.Scenario) {
+			sc.SetExtranonce = &stratumtest.Extranonce{ExtraNonce1: "aabbccdd", ExtraNonce2Size: 8}
+		}, func(t *testing.T, entry *logEntry, err error) {
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertPaysWallet(t, entry, wallet)
+			if entry.ExtraNonce1 != "aabbccdd" || !strings.Contains(entry.CoinbaseRaw.FullHex, "aabbccdd") {
+				t.Errorf("extranonce1 %s not applied to %s", entry.ExtraNonce1, entry.CoinbaseRaw.FullHex)
+			}
+		}},
+		{"zero extranonce2_size", func(sc *stratumtest.Scenario) {
+			sc.ExtraNonce2Size = 0
+			c1, c2, err := stratumtest.BuildCoinbase(925000, "/stratumtest/", 4, []*wire.TxOut{wire.NewTxOut(testSubsidy, addressScript(wallet, &chaincfg.MainNetParams))})
+			if err != nil {
+				t.Fatal(err)
+			}
+			sc.Jobs = []stratumtest.Job{{CoinBase1: c1, CoinBase2: c2}}
+		}, func(t *testing.T, entry *logEntry, err error) {
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertPaysWallet(t, entry, wallet)
+			if got := strings.Join(deviationKindsOf(entry), ","); got != stratum.DeviationZeroExtraNonce2 {
+				t.Errorf("deviations %q, want %q", got, stratum.DeviationZeroExtraNonce2)
+			}
+		}},
+		{"oversized line", func(sc *stratumtest.Scenario) {
+			sc.OversizedLine = 1 << 20
+		}, abuseCheck(stratum.LimitLineBytes)},
+		{"flood", func(sc *stratumtest.Scenario) {
+			sc.Flood = 5000
+		}, abuseCheck(stratum.LimitMessageRate)},
+		{"disconnect after", func(sc *stratumtest.Scenario) {
+			sc.DisconnectAfter = 2
+		}, func(t *testing.T, entry *logEntry, err error) {
+			if err == nil {
+				t.Fatal("hang-up before any job reported no error")
+			}
+			if entry.Connected || entry.Error == "" || entry.Abuse != "" || len(entry.Payouts) != 0 {
+				t.Errorf("entry connected=%v error=%q abuse=%q payouts=%v", entry.Connected, entry.Error, entry.Abuse, entry.Payouts)
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sc := stratumtest.DefaultScenario()
+			sc.Jobs = []stratumtest.Job{job}
+			tt.modify(&sc)
+			entry, err := scanScenario(t, sc, wallet)
+			if entry == nil {
+				t.Fatalf("no entry (err %v)", err)
+			}
+			tt.check(t, entry, err)
+		})
+	}
+}
+
+// abuseCheck expects the session to have been aborted by limit and the
+// report to flag the endpoint as hostile.
+func abuseCheck(limit string) func(t *testing.T, entry *logEntry, err error) {
+	return func(t *testing.T, entry *logEntry, err error) {
+		t.Helper()
+		var limitErr *stratum.LimitError
+		if !errors.As(err, &limitErr) || limitErr.Limit != limit {
+			t.Fatalf("got %v, want a %s limit error", err, limit)
+		}
+		if entry.Connected || entry.Abuse != limit {
+			t.Errorf("entry connected=%v abuse=%q, want %q", entry.Connected, entry.Abuse, limit)
+		}
+		issues, severity := collectIssues(entry, 0)
+		if severity != severityHostile || len(issues) == 0 || issues[len(issues)-1].Message != "hostile/abusive endpoint" {
+			t.Errorf("issues %+v severity %d", issues, severity)
+		}
+	}
+}
+
+func TestCollectFromPoolSessionBytes(t *testing.T) {
+	defer func(l stratum.Limits) { poolLimits = l }(poolLimits)
+	poolLimits = stratum.Limits{MaxSessionBytes: 2000}
+
+	wallet, job := testWallet(t)
+	sc := stratumtest.DefaultScenario()
+	sc.Jobs = []stratumtest.Job{job}
+	sc.Messages = []string{strings.Repeat("m", 900), strings.Repeat("m", 900)}
+	entry, err := scanScenario(t, sc, wallet)
+	abuseCheck(stratum.LimitSessionBytes)(t, entry, err)
+	// The first message arrived before the cap and is kept for the report.
+	if len(entry.ServerMessages) != 1 {
+		t.Errorf("kept %d messages, want 1", len(entry.ServerMessages))
+	}
+}
+
+func TestCollectFromPoolTLS(t *testing.T) {
+	wallet, job := testWallet(t)
+	sc := stratumtest.DefaultScenario()
+	sc.Jobs = []stratumtest.Job{job}
+	srv, err := stratumtest.NewTLSServer(sc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	target := scanTarget{Host: srv.Host(), Port: srv.Port(), TLS: true}
+
+	// With the system roots the self-signed certificate is refused.
+	entry, err := collectFromPool(target, "cgminer/4.10.0", wallet+".rig", wallet, "rig")
+	if err == nil || entry.Connected || !strings.Contains(entry.Error, "certificate") {
+		t.Fatalf("got %v (connected=%v), want a certificate error", err, entry.Connected)
+	}
+
+	defer func(cfg *tls.Config) { poolTLSConfig = cfg }(poolTLSConfig)
+	poolTLSConfig = srv.ClientTLSConfig()
+	entry, err = collectFromPool(target, "cgminer/4.10.0", wallet+".rig", wallet, "rig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertPaysWallet(t, entry, wallet)
+	if !entry.TLS {
+		t.Error("entry not marked TLS")
+	}
+}
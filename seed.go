@@ -0,0 +1,63 @@
+package main
+
+import (
+	"hash/fnv"
+	"math/rand"
+	"time"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+)
+
+// Each random choice a run makes draws from its own stream, derived from the
+// run seed and the stream's purpose. How many sessions reach a job, and so
+// draw an extranonce2, then cannot shift the identities and probes drawn
+// after the scan: the same -seed repeats them whatever the pools did.
+const (
+	streamIdentity     = "identity"
+	streamExtranonce   = "extranonce2"
+	streamProfiles     = "profiles"
+	streamAddressTypes = "address-types"
+	streamSafety       = "safety"
+	streamShuffle      = "shuffle"
+)
+
+var (
+	runSeed int64
+	// extranonceRand supplies every session's extranonce2 in scan order.
+	extranonceRand = newStream(streamExtranonce)
+)
+
+func seedRandom(seed int64) {
+	runSeed = seed
+	extranonceRand = newStream(streamExtranonce)
+}
+
+// newStream returns the run seed's stream for purpose, narrowed by keys such
+// as a pool's host:port so each target's draws stand on their own too.
+func newStream(purpose string, keys ...string) *rand.Rand {
+	h := fnv.New64a()
+	h.Write([]byte(purpose))
+	for _, key := range keys {
+		h.Write([]byte{0})
+		h.Write([]byte(key))
+	}
+	return rand.New(rand.NewSource(runSeed ^ int64(h.Sum64())))
+}
+
+func newRunSeed() int64 {
+	return time.Now().UnixNano()
+}
+
+// newPrivateKey draws a key from r. Generated wallets are throwaway probe
+// identities whose keys are never stored, so reproducibility matters more
+// than key secrecy here.
+func newPrivateKey(r *rand.Rand) *btcec.PrivateKey {
+	var buf [32]byte
+	for {
+		_, _ = r.Read(buf[:])
+		key, _ := btcec.PrivKeyFromBytes(buf[:])
+		if !key.Key.IsZero() {
+			return key
+		}
+	}
+}
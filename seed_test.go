@@ -0,0 +1,65 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"poolcensus/desktop/stratum/stratumtest"
+)
+
+// The same seed repeats the identities and probes drawn after the scan
+// whether or not the scan's sessions reached a job and drew extranonce2.
+func TestSeedRepeatsIdentitiesAcrossScanOutcomes(t *testing.T) {
+	wallet, job := testWallet(t)
+	working := stratumtest.DefaultScenario()
+	working.Jobs = []stratumtest.Job{job}
+	rejecting := stratumtest.DefaultScenario()
+	rejecting.RejectAuthorize = true
+
+	// An endpoint nothing listens on fails every probe without drawing.
+	unreachable := &scanAggregate{target: scanTarget{Host: "127.0.0.1", Port: 1}}
+
+	type draws struct {
+		Profiles     []minerIdentity
+		AddressTypes []string
+		Safety       []string
+	}
+	run := func(sc stratumtest.Scenario, sessions int) draws {
+		t.Helper()
+		seedRandom(42)
+		for i := 0; i < sessions; i++ {
+			if _, err := scanScenario(t, sc, wallet); err != nil && !sc.RejectAuthorize {
+				t.Fatal(err)
+			}
+		}
+		var d draws
+		ids, err := newProfileIdentities(newStream(streamProfiles))
+		if err != nil {
+			t.Fatal(err)
+		}
+		d.Profiles = ids
+
+		agg := *unreachable
+		if err := probeAddressTypes([]*scanAggregate{&agg}, "cgminer/4.10.0", "rig"); err != nil {
+			t.Fatal(err)
+		}
+		if err := probeSafety([]*scanAggregate{&agg}, "cgminer/4.10.0", "rig"); err != nil {
+			t.Fatal(err)
+		}
+		for _, check := range agg.addressChecks {
+			d.AddressTypes = append(d.AddressTypes, check.Wallet)
+		}
+		for _, check := range agg.safetyChecks {
+			d.Safety = append(d.Safety, check.Wallet)
+		}
+		return d
+	}
+
+	want := run(working, 3)
+	if len(want.Profiles) != len(identityProfiles) || len(want.AddressTypes) != len(walletAddressTypes) || len(want.Safety) == 0 {
+		t.Fatalf("draws %+v", want)
+	}
+	if got := run(rejecting, 1); !reflect.DeepEqual(got, want) {
+		t.Errorf("after a failed scan:\n got %+v\nwant %+v", got, want)
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// versionSignals is a job's block version decoded into BIP9 deployment bits
+// and BIP320 version-rolling bits.
+type versionSignals struct {
+	Version uint32
+	// BIP9 is set when the top bits read 001, the only case in which the
+	// lower bits signal anything.
+	BIP9        bool
+	Deployments []string
+	// Stale holds set bits of buried deployments, which no longer signal
+	// anything and are left over from old templates.
+	Stale []string
+	// Unknown holds set bits outside the rolling range that no known
+	// deployment uses.
+	Unknown []int
+	Rolling uint32
+}
+
+// Label summarizes the signals for the dashboard.
+func (s *versionSignals) Label() string {
+	switch {
+	case !s.BIP9:
+		return fmt.Sprintf("not BIP9 (version %08x)", s.Version)
+	case len(s.Deployments) == 0 && len(s.Unknown) == 0 && len(s.Stale) == 0:
+		return "no deployment signals"
+	}
+	parts := append([]string(nil), s.Deployments...)
+	for _, bit := range s.Unknown {
+		parts = append(parts, fmt.Sprintf("unknown bit %d", bit))
+	}
+	var labels []string
+	if len(parts) > 0 {
+		labels = append(labels, "signalling for "+strings.Join(parts, ", "))
+	}
+	if len(s.Stale) > 0 {
+		labels = append(labels, "stale bits for buried "+strings.Join(s.Stale, ", "))
+	}
+	return strings.Join(labels, "; ")
+}
+
+// decodeVersionSignals decodes a job's version hex; it returns nil when the
+// pool sent no usable version.
+func decodeVersionSignals(versionHex, network string) *versionSignals {
+	version, ok := parseWord(versionHex)
+	if !ok {
+		return nil
+	}
+	s := &versionSignals{
+		Version: version,
+		BIP9:    version&versionBitsMask == versionBitsTop,
+		Rolling: version & versionRollingMask,
+	}
+	if !s.BIP9 {
+		return s
+	}
+	for bit := 0; bit <= 28; bit++ {
+		if version&(1<<bit) == 0 {
+			continue
+		}
+		if d, ok := deploymentForBit(bit, network); ok {
+			if d.Buried() {
+				s.Stale = append(s.Stale, d.Name)
+			} else {
+				s.Deployments = append(s.Deployments, d.Name)
+			}
+			continue
+		}
+		if versionRollingMask&(1<<bit) == 0 {
+			s.Unknown = append(s.Unknown, bit)
+		}
+	}
+	return s
+}
+
+// signallingRow counts the pools on one network signalling one bit.
+type signallingRow struct {
+	Network    string
+	Deployment string
+	Bit        int
+	// Stale is set for a buried deployment's bit.
+	Stale bool
+	Pools int
+	Of    int
+}
+
+// Percent is the share of the network's scanned pools signalling.
+func (r signallingRow) Percent() float64 {
+	return float64(r.Pools) / float64(r.Of) * 100
+}
+
+// summarizeSignalling counts, per network, how many scanned pools signal each
+// known deployment and any unknown bit. Live deployments nobody signals are
+// listed too so the table shows what was checked; buried ones only appear when
+// a pool still sets their bit.
+func summarizeSignalling(views []*entryView) []signallingRow {
+	type key struct {
+		network string
+		bit     int
+	}
+	totals := make(map[string]int)
+	counts := make(map[key]int)
+	for _, v := range views {
+		if v.Signals == nil {
+			continue
+		}
+		network := firstNonEmpty(v.Network, networkMainnet)
+		totals[network]++
+		if !v.Signals.BIP9 {
+			continue
+		}
+		for bit := 0; bit <= 28; bit++ {
+			if v.Signals.Version&(1<<bit) != 0 {
+				counts[key{network, bit}]++
+			}
+		}
+	}
+
+	var rows []signallingRow
+	for network, total := range totals {
+		for bit := 0; bit <= 28; bit++ {
+			d, known := deploymentForBit(bit, network)
+			pools := counts[key{network, bit}]
+			if !known && (pools == 0 || versionRollingMask&(1<<bit) != 0) {
+				continue
+			}
+			if known && d.Buried() && pools == 0 {
+				continue
+			}
+			name := d.Name
+			if !known {
+				name = "unknown"
+			}
+			rows = append(rows, signallingRow{Network: network, Deployment: name, Bit: bit, Stale: known && d.Buried(), Pools: pools, Of: total})
+		}
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].Network != rows[j].Network {
+			return rows[i].Network < rows[j].Network
+		}
+		return rows[i].Bit < rows[j].Bit
+	})
+	return rows
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestDecodeVersionSignals(t *testing.T) {
+	cases := []struct {
+		name    string
+		version string
+		label   string
+	}{
+		{"plain", "20000000", "no deployment signals"},
+		{"not bip9", "00000004", "not BIP9 (version 00000004)"},
+		{"buried segwit", "20000002", "stale bits for buried segwit"},
+		{"buried csv and taproot", "20000005", "stale bits for buried csv, taproot"},
+		{"live deployment", "30000000", "signalling for testdummy"},
+		{"unknown bit", "20000010", "signalling for unknown bit 4"},
+		{"live and buried", "30000002", "signalling for testdummy; stale bits for buried segwit"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s := decodeVersionSignals(c.version, networkMainnet)
+			if s == nil {
+				t.Fatal("no signals decoded")
+			}
+			if got := s.Label(); got != c.label {
+				t.Errorf("label %q, want %q", got, c.label)
+			}
+		})
+	}
+}
+
+func TestSummarizeSignallingFlagsBuriedBits(t *testing.T) {
+	views := []*entryView{
+		{Signals: decodeVersionSignals("20000002", networkMainnet)},
+		{Signals: decodeVersionSignals("20000000", networkMainnet)},
+	}
+	var rows []string
+	for _, r := range summarizeSignalling(views) {
+		rows = append(rows, fmt.Sprintf("%s %s %d stale=%t %d/%d", r.Network, r.Deployment, r.Bit, r.Stale, r.Pools, r.Of))
+	}
+	assertStrings(t, "rows", rows, []string{
+		"mainnet segwit 1 stale=true 1/2",
+		"mainnet testdummy 28 stale=false 0/2",
+	})
+}
@@ -2,12 +2,16 @@ package stratum
 
 import (
 	"bufio"
+	"bytes"
+	"context"
 	"crypto/tls"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"net"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
@@ -18,25 +22,59 @@ type Client struct {
 	username string
 	password string
 	useTLS   bool
+	agent    string
+
+	transcript *Transcript
+	tlsConfig  *tls.Config
 
 	mu             sync.RWMutex
 	conn           net.Conn
-	reader         *bufio.Reader
+	reader         *limitedReader
+	limits         Limits
+	abortErr       error
 	nextID         int
 	pending        map[int]chan rpcResponse
 	closeOnce      sync.Once
 	closed         chan struct{}
+	releaseOnce    sync.Once
+	released       chan struct{}
 	extraNonce1    string
 	extraNonce2Len int
+	deviations     []Deviation
+	readLoopReady  chan struct{}
+
+	// writeMu serializes writes from send and the read loop's replies, so
+	// lines never interleave on the wire or in the transcript.
+	writeMu sync.Mutex
+
+	// Events are queued by the read loop and forwarded by pumpEvents, so a
+	// consumer that falls behind never blocks RPC responses.
+	events     chan Event
+	queueMu    sync.Mutex
+	queue      []Event
+	queueReady chan struct{}
+	queueDone  bool
+}
+
+// Option configures a Client.
+type Option func(*Client)
 
-	OnNotify      func(params *NotifyParams)
-	OnDifficulty  func(diff float64)
-	OnDisconnect  func(err error)
-	readLoopReady chan struct{}
+// WithTranscript records every line sent and received into t.
+func WithTranscript(t *Transcript) Option {
+	return func(c *Client) {
+		c.transcript = t
+	}
 }
 
-func NewClient(host string, port int, username, password string, useTLS bool) *Client {
-	return &Client{
+// WithTLSConfig replaces the default TLS settings for TLS endpoints.
+func WithTLSConfig(cfg *tls.Config) Option {
+	return func(c *Client) {
+		c.tlsConfig = cfg
+	}
+}
+
+func NewClient(host string, port int, username, password string, useTLS bool, opts ...Option) *Client {
+	c := &Client{
 		host:          host,
 		port:          port,
 		username:      username,
@@ -44,40 +82,76 @@ func NewClient(host string, port int, username, password string, useTLS bool) *C
 		useTLS:        useTLS,
 		pending:       make(map[int]chan rpcResponse),
 		closed:        make(chan struct{}),
+		released:      make(chan struct{}),
 		readLoopReady: make(chan struct{}),
+		events:        make(chan Event, 16),
+		queueReady:    make(chan struct{}, 1),
+		limits:        DefaultLimits(),
 	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
 }
 
-func (c *Client) Connect() error {
+// Events delivers server notifications in arrival order. The channel is
+// closed after a DisconnectEvent once the connection ends.
+func (c *Client) Events() <-chan Event {
+	return c.events
+}
+
+func (c *Client) Connect(ctx context.Context) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
 	if c.conn != nil {
 		return nil
 	}
+	select {
+	case <-c.closed:
+		return ErrConnectionClosed
+	default:
+	}
 
 	addr := net.JoinHostPort(c.host, strconv.Itoa(c.port))
 	dialer := &net.Dialer{Timeout: 12 * time.Second, KeepAlive: 30 * time.Second}
 	var conn net.Conn
 	var err error
 	if c.useTLS {
-		conn, err = tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{ServerName: c.host})
+		cfg := &tls.Config{ServerName: c.host}
+		if c.tlsConfig != nil {
+			cfg = c.tlsConfig.Clone()
+			if cfg.ServerName == "" {
+				cfg.ServerName = c.host
+			}
+		}
+		tlsDialer := &tls.Dialer{NetDialer: dialer, Config: cfg}
+		conn, err = tlsDialer.DialContext(ctx, "tcp", addr)
 	} else {
-		conn, err = dialer.Dial("tcp", addr)
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
 	}
 	if err != nil {
 		return err
 	}
 
 	c.conn = conn
-	c.reader = bufio.NewReaderSize(conn, 256*1024)
+	c.reader = &limitedReader{r: bufio.NewReaderSize(conn, 64*1024), limits: c.limits}
 
+	go c.pumpEvents()
 	go c.readLoop()
 	<-c.readLoopReady
 	return nil
 }
 
+// Close ends the session. Events still queued are discarded.
 func (c *Client) Close() {
+	c.releaseOnce.Do(func() {
+		close(c.released)
+	})
+	c.shutdown()
+}
+
+func (c *Client) shutdown() {
 	c.closeOnce.Do(func() {
 		close(c.closed)
 		c.mu.Lock()
@@ -93,6 +167,17 @@ func (c *Client) Close() {
 	})
 }
 
+// closedErr explains why calls fail once the connection has ended: the
+// exceeded limit if the session was aborted, ErrConnectionClosed otherwise.
+func (c *Client) closedErr() error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.abortErr != nil {
+		return c.abortErr
+	}
+	return ErrConnectionClosed
+}
+
 func (c *Client) ExtraNonce1() string {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
@@ -105,21 +190,49 @@ func (c *Client) ExtraNonce2Size() int {
 	return c.extraNonce2Len
 }
 
-func (c *Client) Subscribe(agent string) error {
+// Deviations returns the protocol deviations observed so far in this session.
+func (c *Client) Deviations() []Deviation {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return append([]Deviation(nil), c.deviations...)
+}
+
+func (c *Client) recordDeviation(kind, format string, args ...any) {
+	c.mu.Lock()
+	c.deviations = append(c.deviations, Deviation{Kind: kind, Detail: fmt.Sprintf(format, args...)})
+	c.mu.Unlock()
+}
+
+func (c *Client) Subscribe(ctx context.Context, agent string) error {
+	const method = "mining.subscribe"
+	c.mu.Lock()
+	c.agent = agent
+	c.mu.Unlock()
+
 	var result []any
-	if err := c.call("mining.subscribe", []any{agent}, &result); err != nil {
+	if err := c.call(ctx, method, []any{agent}, &result); err != nil {
 		return err
 	}
 	if len(result) < 3 {
-		return fmt.Errorf("mining.subscribe: unexpected result")
+		return &ProtocolError{Method: method, Reason: "unexpected result"}
 	}
 	en1, ok := result[1].(string)
 	if !ok || en1 == "" {
-		return fmt.Errorf("mining.subscribe: missing extranonce1")
+		return &ProtocolError{Method: method, Reason: "missing extranonce1"}
+	}
+	if _, err := hex.DecodeString(en1); err != nil {
+		c.recordDeviation(DeviationMalformedParams, "mining.subscribe: extranonce1 %q is not hex", en1)
 	}
 	en2sizeFloat, ok := result[2].(float64)
 	if !ok {
-		return fmt.Errorf("mining.subscribe: missing extranonce2_size")
+		return &ProtocolError{Method: method, Reason: "missing extranonce2_size"}
+	}
+	if !validExtraNonce2Size(en2sizeFloat) {
+		c.recordDeviation(DeviationBadExtraNonce2, "mining.subscribe: extranonce2_size %v", en2sizeFloat)
+		return &ProtocolError{Method: method, Reason: fmt.Sprintf("extranonce2_size %v is not a whole number of bytes from 0-%d", en2sizeFloat, MaxExtraNonce2Size)}
+	}
+	if en2sizeFloat == 0 {
+		c.recordDeviation(DeviationZeroExtraNonce2, "mining.subscribe: extranonce2_size 0")
 	}
 
 	c.mu.Lock()
@@ -129,21 +242,27 @@ func (c *Client) Subscribe(agent string) error {
 	return nil
 }
 
-func (c *Client) Authorize() error {
+func (c *Client) Authorize(ctx context.Context) error {
 	var ok bool
-	if err := c.call("mining.authorize", []any{c.username, c.password}, &ok); err != nil {
+	if err := c.call(ctx, "mining.authorize", []any{c.username, c.password}, &ok); err != nil {
 		return err
 	}
 	if !ok {
-		return errors.New("authorization rejected")
+		return ErrAuthorizationRejected
 	}
 	return nil
 }
 
 type rpcRequest struct {
-	ID     int           `json:"id"`
-	Method string        `json:"method"`
-	Params []any         `json:"params"`
+	ID     int    `json:"id"`
+	Method string `json:"method"`
+	Params []any  `json:"params"`
+}
+
+type rpcReply struct {
+	ID     int `json:"id"`
+	Result any `json:"result"`
+	Error  any `json:"error"`
 }
 
 type rpcEnvelope struct {
@@ -159,31 +278,36 @@ type rpcResponse struct {
 	Error  any
 }
 
-func (c *Client) call(method string, params []any, out any) error {
-	resp, err := c.send(method, params)
+func (c *Client) call(ctx context.Context, method string, params []any, out any) error {
+	resp, err := c.send(ctx, method, params)
 	if err != nil {
 		return err
 	}
 	if resp.Error != nil {
-		return fmt.Errorf("%s: %v", method, resp.Error)
+		return newRPCError(method, resp.Error)
 	}
 	if out == nil {
 		return nil
 	}
 	if len(resp.Result) == 0 || string(resp.Result) == "null" {
-		return fmt.Errorf("%s: empty result", method)
+		return &ProtocolError{Method: method, Reason: "empty result"}
 	}
 	if err := json.Unmarshal(resp.Result, out); err != nil {
-		return fmt.Errorf("%s: %w", method, err)
+		return &ProtocolError{Method: method, Reason: err.Error()}
 	}
 	return nil
 }
 
-func (c *Client) send(method string, params []any) (rpcResponse, error) {
+func (c *Client) send(ctx context.Context, method string, params []any) (rpcResponse, error) {
 	c.mu.Lock()
 	if c.conn == nil {
 		c.mu.Unlock()
-		return rpcResponse{}, errors.New("not connected")
+		select {
+		case <-c.closed:
+			return rpcResponse{}, c.closedErr()
+		default:
+			return rpcResponse{}, ErrNotConnected
+		}
 	}
 	c.nextID++
 	id := c.nextID
@@ -192,38 +316,99 @@ func (c *Client) send(method string, params []any) (rpcResponse, error) {
 	conn := c.conn
 	c.mu.Unlock()
 
+	forget := func() {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+	}
+
 	req := rpcRequest{ID: id, Method: method, Params: params}
 	payload, err := json.Marshal(req)
 	if err != nil {
+		forget()
 		return rpcResponse{}, err
 	}
-	payload = append(payload, '\n')
-	if _, err := conn.Write(payload); err != nil {
-		c.mu.Lock()
-		delete(c.pending, id)
-		c.mu.Unlock()
+	if err := c.writeLine(conn, payload); err != nil {
+		forget()
 		return rpcResponse{}, err
 	}
 
 	select {
 	case resp, ok := <-respCh:
 		if !ok {
-			return rpcResponse{}, errors.New("connection closed")
+			return rpcResponse{}, c.closedErr()
 		}
 		return resp, nil
 	case <-c.closed:
-		return rpcResponse{}, errors.New("connection closed")
-	case <-time.After(20 * time.Second):
-		c.mu.Lock()
-		delete(c.pending, id)
-		c.mu.Unlock()
-		return rpcResponse{}, fmt.Errorf("%s: timeout", method)
+		return rpcResponse{}, c.closedErr()
+	case <-ctx.Done():
+		forget()
+		return rpcResponse{}, fmt.Errorf("%s: %w", method, ctx.Err())
+	}
+}
+
+// emit queues ev for delivery on Events.
+func (c *Client) emit(ev Event) {
+	c.queueMu.Lock()
+	c.queue = append(c.queue, ev)
+	c.queueMu.Unlock()
+	select {
+	case c.queueReady <- struct{}{}:
+	default:
+	}
+}
+
+func (c *Client) finishEvents(err error) {
+	c.emit(DisconnectEvent{Err: err})
+	c.queueMu.Lock()
+	c.queueDone = true
+	c.queueMu.Unlock()
+	select {
+	case c.queueReady <- struct{}{}:
+	default:
+	}
+}
+
+func (c *Client) pumpEvents() {
+	defer close(c.events)
+	for {
+		c.queueMu.Lock()
+		batch := c.queue
+		c.queue = nil
+		done := c.queueDone
+		c.queueMu.Unlock()
+
+		for _, ev := range batch {
+			select {
+			case c.events <- ev:
+			case <-c.released:
+				return
+			}
+		}
+		if done && len(batch) == 0 {
+			return
+		}
+		if len(batch) > 0 {
+			continue
+		}
+		select {
+		case <-c.queueReady:
+		case <-c.released:
+			return
+		}
 	}
 }
 
 func (c *Client) readLoop() {
+	var loopErr error
 	defer func() {
-		c.Close()
+		select {
+		case <-c.released:
+			loopErr = nil
+		default:
+		}
+		c.shutdown()
+		c.finishEvents(loopErr)
 	}()
 	close(c.readLoopReady)
 
@@ -234,16 +419,28 @@ func (c *Client) readLoop() {
 		default:
 		}
 
-		line, err := readLine(c.reader)
+		line, err := c.reader.readLine()
 		if err != nil {
-			if c.OnDisconnect != nil {
-				c.OnDisconnect(err)
+			loopErr = err
+			if errors.Is(err, ErrLimitExceeded) {
+				c.mu.Lock()
+				c.abortErr = err
+				c.mu.Unlock()
 			}
 			return
 		}
+		c.transcript.record(DirectionReceived, line)
 
 		var env rpcEnvelope
 		if err := json.Unmarshal(line, &env); err != nil {
+			if len(bytes.TrimSpace(line)) > 0 {
+				c.recordDeviation(DeviationInvalidJSON, "%s", summarizeLine(line))
+			}
+			continue
+		}
+
+		if env.ID != nil && env.Method != "" {
+			c.handleRequest(*env.ID, env.Method)
 			continue
 		}
 
@@ -255,6 +452,8 @@ func (c *Client) readLoop() {
 			if respCh != nil {
 				respCh <- rpcResponse{Result: env.Result, Error: env.Error}
 				close(respCh)
+			} else {
+				c.recordDeviation(DeviationUnexpectedResponse, "response for unknown id %d", *env.ID)
 			}
 			continue
 		}
@@ -263,46 +462,94 @@ func (c *Client) readLoop() {
 		case "mining.notify":
 			params, err := decodeNotifyParams(env.Params)
 			if err != nil {
+				c.recordDeviation(DeviationMalformedNotify, "%v", err)
 				continue
 			}
-			if c.OnNotify != nil {
-				c.OnNotify(params)
-			}
+			c.mu.RLock()
+			ev := NotifyEvent{Params: params, ExtraNonce1: c.extraNonce1, ExtraNonce2Size: c.extraNonce2Len, Received: time.Now()}
+			c.mu.RUnlock()
+			c.emit(ev)
 		case "mining.set_extranonce":
-			en1, en2, err := decodeExtranonce(env.Params)
+			en1, en2size, err := decodeExtranonce(env.Params)
 			if err != nil {
+				c.recordDeviation(DeviationMalformedParams, "%v", err)
+				continue
+			}
+			if !validExtraNonce2Size(en2size) {
+				c.recordDeviation(DeviationBadExtraNonce2, "set_extranonce: extranonce2_size %v", en2size)
 				continue
 			}
+			if en2size == 0 {
+				c.recordDeviation(DeviationZeroExtraNonce2, "set_extranonce: extranonce2_size 0")
+			}
+			en2 := int(en2size)
 			c.mu.Lock()
 			if en1 != "" {
 				c.extraNonce1 = en1
 			}
-			if en2 > 0 {
-				c.extraNonce2Len = en2
-			}
+			c.extraNonce2Len = en2
+			ev := ExtranonceEvent{ExtraNonce1: c.extraNonce1, ExtraNonce2Size: c.extraNonce2Len}
 			c.mu.Unlock()
+			c.emit(ev)
 		case "mining.set_difficulty":
 			diff := decodeDifficulty(env.Params)
-			if c.OnDifficulty != nil && diff > 0 {
-				c.OnDifficulty(diff)
+			if diff <= 0 {
+				c.recordDeviation(DeviationMalformedParams, "set_difficulty: invalid difficulty %s", summarizeLine(env.Params))
+				continue
+			}
+			c.emit(DifficultyEvent{Difficulty: diff})
+		case "client.show_message":
+			msg, err := decodeMessage(env.Params)
+			if err != nil {
+				c.recordDeviation(DeviationMalformedParams, "%v", err)
+				continue
 			}
+			c.emit(MessageEvent{Message: msg})
+		case "":
+			c.recordDeviation(DeviationUnknownMethod, "notification without method")
+		default:
+			c.recordDeviation(DeviationUnknownMethod, "unhandled method %q", env.Method)
 		}
 	}
 }
 
-func readLine(r *bufio.Reader) ([]byte, error) {
-	var out []byte
-	for {
-		chunk, err := r.ReadBytes('\n')
-		out = append(out, chunk...)
-		if err == nil {
-			return out, nil
-		}
-		if errors.Is(err, bufio.ErrBufferFull) {
-			continue
-		}
-		return nil, err
+// handleRequest answers server-initiated requests. Only client.get_version is
+// supported; anything else gets a JSON-RPC error so the pool is not left waiting.
+func (c *Client) handleRequest(id int, method string) {
+	switch method {
+	case "client.get_version":
+		c.mu.RLock()
+		agent := c.agent
+		c.mu.RUnlock()
+		_ = c.reply(rpcReply{ID: id, Result: agent})
+	default:
+		c.recordDeviation(DeviationUnknownMethod, "unhandled request %q", method)
+		_ = c.reply(rpcReply{ID: id, Error: []any{20, "unsupported method", nil}})
+	}
+}
+
+func (c *Client) reply(resp rpcReply) error {
+	c.mu.RLock()
+	conn := c.conn
+	c.mu.RUnlock()
+	if conn == nil {
+		return ErrNotConnected
 	}
+	payload, err := json.Marshal(resp)
+	if err != nil {
+		return err
+	}
+	return c.writeLine(conn, payload)
+}
+
+// writeLine records and writes one newline-terminated line under writeMu.
+func (c *Client) writeLine(conn net.Conn, payload []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	payload = append(payload, '\n')
+	c.transcript.record(DirectionSent, payload)
+	_, err := conn.Write(payload)
+	return err
 }
 
 func decodeNotifyParams(raw json.RawMessage) (*NotifyParams, error) {
@@ -311,7 +558,7 @@ func decodeNotifyParams(raw json.RawMessage) (*NotifyParams, error) {
 		return nil, err
 	}
 	if len(arr) < 4 {
-		return nil, errors.New("notify: too few params")
+		return nil, fmt.Errorf("notify: too few params (%d)", len(arr))
 	}
 	var coinbase1, coinbase2 string
 	if err := json.Unmarshal(arr[2], &coinbase1); err != nil {
@@ -320,7 +567,63 @@ func decodeNotifyParams(raw json.RawMessage) (*NotifyParams, error) {
 	if err := json.Unmarshal(arr[3], &coinbase2); err != nil {
 		return nil, err
 	}
-	return &NotifyParams{CoinBase1: coinbase1, CoinBase2: coinbase2}, nil
+	if _, err := hex.DecodeString(coinbase1); err != nil {
+		return nil, fmt.Errorf("notify: coinbase1 is not hex: %w", err)
+	}
+	if _, err := hex.DecodeString(coinbase2); err != nil {
+		return nil, fmt.Errorf("notify: coinbase2 is not hex: %w", err)
+	}
+	var prevHash string
+	_ = json.Unmarshal(arr[1], &prevHash)
+	params := &NotifyParams{PrevHash: displayPrevHash(prevHash), CoinBase1: coinbase1, CoinBase2: coinbase2}
+	if len(arr) > 4 {
+		if err := json.Unmarshal(arr[4], &params.MerkleBranch); err != nil {
+			return nil, fmt.Errorf("notify: merkle branch is not a list of hex strings: %w", err)
+		}
+	}
+	if len(arr) > 7 {
+		params.Version = headerWord(arr[5])
+		params.NBits = headerWord(arr[6])
+		params.NTime = headerWord(arr[7])
+	}
+	return params, nil
+}
+
+// headerWord returns a notify field that should be a 4-byte hex word, or ""
+// if it is not one.
+func headerWord(raw json.RawMessage) string {
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil || len(s) != 8 {
+		return ""
+	}
+	if _, err := hex.DecodeString(s); err != nil {
+		return ""
+	}
+	return strings.ToLower(s)
+}
+
+// displayPrevHash converts mining.notify's prevhash, whose 4-byte words are
+// each byte-swapped from the header order, to the display order block
+// explorers use. That amounts to reversing the order of the words.
+func displayPrevHash(prevHash string) string {
+	raw, err := hex.DecodeString(prevHash)
+	if err != nil || len(raw) != 32 {
+		return ""
+	}
+	out := make([]byte, 0, 32)
+	for i := 28; i >= 0; i -= 4 {
+		out = append(out, raw[i:i+4]...)
+	}
+	return hex.EncodeToString(out)
+}
+
+func summarizeLine(line []byte) string {
+	const maxLen = 120
+	trimmed := bytes.TrimSpace(line)
+	if len(trimmed) > maxLen {
+		return string(trimmed[:maxLen]) + "..."
+	}
+	return string(trimmed)
 }
 
 func decodeDifficulty(raw json.RawMessage) float64 {
@@ -333,7 +636,7 @@ func decodeDifficulty(raw json.RawMessage) float64 {
 	return diff
 }
 
-func decodeExtranonce(raw json.RawMessage) (string, int, error) {
+func decodeExtranonce(raw json.RawMessage) (string, float64, error) {
 	var arr []json.RawMessage
 	if err := json.Unmarshal(raw, &arr); err != nil {
 		return "", 0, err
@@ -349,5 +652,20 @@ func decodeExtranonce(raw json.RawMessage) (string, int, error) {
 	if err := json.Unmarshal(arr[1], &en2sizeFloat); err != nil {
 		return "", 0, err
 	}
-	return en1, int(en2sizeFloat), nil
+	return en1, en2sizeFloat, nil
+}
+
+func decodeMessage(raw json.RawMessage) (string, error) {
+	var arr []json.RawMessage
+	if err := json.Unmarshal(raw, &arr); err != nil {
+		return "", err
+	}
+	if len(arr) < 1 {
+		return "", errors.New("show_message: too few params")
+	}
+	var msg string
+	if err := json.Unmarshal(arr[0], &msg); err != nil {
+		return "", err
+	}
+	return msg, nil
 }
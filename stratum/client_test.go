@@ -0,0 +1,511 @@
+package stratum_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/wire"
+
+	"poolcensus/desktop/stratum"
+	"poolcensus/desktop/stratum/stratumtest"
+)
+
+// testJob returns a job whose coinbase pays 3.125 BTC to a P2WPKH script and
+// leaves room for a 4 byte extranonce1 and an 8 byte extranonce2.
+func testJob(t *testing.T) stratumtest.Job {
+	t.Helper()
+	pkScript := append([]byte{0x00, 0x14}, make([]byte, 20)...)
+	c1, c2, err := stratumtest.BuildCoinbase(925000, "/stratumtest/", 12, []*wire.TxOut{wire.NewTxOut(312500000, pkScript)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return stratumtest.Job{CoinBase1: c1, CoinBase2: c2}
+}
+
+func startServer(t *testing.T, sc stratumtest.Scenario) *stratumtest.Server {
+	t.Helper()
+	srv, err := stratumtest.NewServer(sc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func connect(t *testing.T, srv *stratumtest.Server, useTLS bool, opts ...stratum.Option) *stratum.Client {
+	t.Helper()
+	c := stratum.NewClient(srv.Host(), srv.Port(), "worker", "x", useTLS, opts...)
+	t.Cleanup(c.Close)
+	if err := c.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// handshake subscribes and authorizes, failing the test on either error.
+func handshake(t *testing.T, c *stratum.Client) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := c.Subscribe(ctx, "cgminer/4.10.0"); err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	if err := c.Authorize(ctx); err != nil {
+		t.Fatalf("authorize: %v", err)
+	}
+}
+
+// collect returns events up to and including the first one that satisfies
+// done, or the DisconnectEvent that ends the stream.
+func collect(t *testing.T, c *stratum.Client, done func(stratum.Event) bool) []stratum.Event {
+	t.Helper()
+	var events []stratum.Event
+	timeout := time.After(10 * time.Second)
+	for {
+		select {
+		case ev, ok := <-c.Events():
+			if !ok {
+				return events
+			}
+			events = append(events, ev)
+			if _, isDisconnect := ev.(stratum.DisconnectEvent); isDisconnect || done(ev) {
+				return events
+			}
+		case <-timeout:
+			t.Fatalf("timed out after %d events", len(events))
+		}
+	}
+}
+
+func isNotify(ev stratum.Event) bool {
+	_, ok := ev.(stratum.NotifyEvent)
+	return ok
+}
+
+func lastNotify(t *testing.T, events []stratum.Event) stratum.NotifyEvent {
+	t.Helper()
+	if len(events) > 0 {
+		if n, ok := events[len(events)-1].(stratum.NotifyEvent); ok {
+			return n
+		}
+	}
+	t.Fatalf("no notify in %#v", events)
+	return stratum.NotifyEvent{}
+}
+
+func deviationKinds(c *stratum.Client) []string {
+	var kinds []string
+	for _, d := range c.Deviations() {
+		kinds = append(kinds, d.Kind)
+	}
+	return kinds
+}
+
+func disconnectErr(t *testing.T, events []stratum.Event) error {
+	t.Helper()
+	if len(events) > 0 {
+		if d, ok := events[len(events)-1].(stratum.DisconnectEvent); ok {
+			return d.Err
+		}
+	}
+	t.Fatalf("no disconnect in %#v", events)
+	return nil
+}
+
+func TestClientDefaultScenario(t *testing.T) {
+	sc := stratumtest.DefaultScenario()
+	job := testJob(t)
+	sc.Jobs = []stratumtest.Job{job}
+	sc.Messages = []string{"welcome"}
+	srv := startServer(t, sc)
+	c := connect(t, srv, false)
+	handshake(t, c)
+
+	events := collect(t, c, isNotify)
+	n := lastNotify(t, events)
+	if n.ExtraNonce1 != "f000000f" || n.ExtraNonce2Size != 8 || n.Params.CoinBase1 != job.CoinBase1 || n.Params.CoinBase2 != job.CoinBase2 {
+		t.Errorf("notify %+v, params %+v", n, n.Params)
+	}
+	var diff float64
+	var messages []string
+	for _, ev := range events {
+		switch ev := ev.(type) {
+		case stratum.DifficultyEvent:
+			diff = ev.Difficulty
+		case stratum.MessageEvent:
+			messages = append(messages, ev.Message)
+		}
+	}
+	if diff != 1024 {
+		t.Errorf("difficulty %v, want 1024", diff)
+	}
+	if len(messages) != 1 || messages[0] != "welcome" {
+		t.Errorf("messages %q", messages)
+	}
+	if kinds := deviationKinds(c); len(kinds) != 0 {
+		t.Errorf("deviations %v on a conforming pool", kinds)
+	}
+
+	received := srv.Received()
+	if len(received) < 2 || !strings.Contains(received[0], `"mining.subscribe"`) || !strings.Contains(received[0], "cgminer/4.10.0") || !strings.Contains(received[1], `"mining.authorize"`) {
+		t.Errorf("server received %q", received)
+	}
+}
+
+func TestClientSubscribeDelay(t *testing.T) {
+	sc := stratumtest.DefaultScenario()
+	sc.SubscribeDelay = 500 * time.Millisecond
+	srv := startServer(t, sc)
+	c := connect(t, srv, false)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	err := c.Subscribe(ctx, "cgminer/4.10.0")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want a deadline error", err)
+	}
+
+	// The late response belongs to nobody any more.
+	c2 := connect(t, srv, false)
+	start := time.Now()
+	handshake(t, c2)
+	if elapsed := time.Since(start); elapsed < sc.SubscribeDelay {
+		t.Errorf("subscribe returned after %v, before the scripted delay", elapsed)
+	}
+}
+
+func TestClientGarbageLines(t *testing.T) {
+	sc := stratumtest.DefaultScenario()
+	sc.GarbageLines = []string{
+		"HTTP/1.1 400 Bad Request",
+		`{"id":99,"result":true,"error":null}`,
+		`{"id":null,"method":"mining.bogus","params":[]}`,
+		`{"id":null,"method":"mining.set_difficulty","params":[-1]}`,
+		"",
+	}
+	sc.Jobs = []stratumtest.Job{testJob(t)}
+	srv := startServer(t, sc)
+	c := connect(t, srv, false)
+	handshake(t, c)
+	lastNotify(t, collect(t, c, isNotify))
+
+	want := []string{
+		stratum.DeviationInvalidJSON,
+		stratum.DeviationUnexpectedResponse,
+		stratum.DeviationUnknownMethod,
+		stratum.DeviationMalformedParams,
+	}
+	if got := deviationKinds(c); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("deviations %v, want %v", got, want)
+	}
+}
+
+func TestClientRejectAuthorize(t *testing.T) {
+	sc := stratumtest.DefaultScenario()
+	sc.RejectAuthorize = true
+	srv := startServer(t, sc)
+	c := connect(t, srv, false)
+
+	ctx := context.Background()
+	if err := c.Subscribe(ctx, "cgminer/4.10.0"); err != nil {
+		t.Fatal(err)
+	}
+	err := c.Authorize(ctx)
+	var rpcErr *stratum.RPCError
+	if !errors.As(err, &rpcErr) || rpcErr.Code != 24 || rpcErr.Message != "Unauthorized worker" || rpcErr.Method != "mining.authorize" {
+		t.Fatalf("got %#v, want the pool's RPC error", err)
+	}
+}
+
+func TestClientNotifyBeforeAuthorize(t *testing.T) {
+	sc := stratumtest.DefaultScenario()
+	sc.NotifyBeforeAuthorize = true
+	sc.AuthorizeDelay = 200 * time.Millisecond
+	sc.Jobs = []stratumtest.Job{testJob(t)}
+	srv := startServer(t, sc)
+	c := connect(t, srv, false)
+
+	ctx := context.Background()
+	if err := c.Subscribe(ctx, "cgminer/4.10.0"); err != nil {
+		t.Fatal(err)
+	}
+	authorized := make(chan error, 1)
+	go func() { authorized <- c.Authorize(ctx) }()
+
+	n := lastNotify(t, collect(t, c, isNotify))
+	select {
+	case err := <-authorized:
+		t.Fatalf("authorize returned (%v) before the early job was delivered", err)
+	default:
+	}
+	if n.ExtraNonce1 != "f000000f" || n.ExtraNonce2Size != 8 {
+		t.Errorf("early notify %+v, want the subscribe extranonce", n)
+	}
+	if err := <-authorized; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClientSetExtranonce(t *testing.T) {
+	tests := []struct {
+		name       string
+		extranonce stratumtest.Extranonce
+		wantEN1    string
+		wantSize   int
+		wantDev    string
+		applied    bool
+	}{
+		{"applied", stratumtest.Extranonce{ExtraNonce1: "aabbccdd", ExtraNonce2Size: 4}, "aabbccdd", 4, "", true},
+		{"zero size", stratumtest.Extranonce{ExtraNonce1: "aabbccdd", ExtraNonce2Size: 0}, "aabbccdd", 0, stratum.DeviationZeroExtraNonce2, true},
+		{"oversized", stratumtest.Extranonce{ExtraNonce1: "aabbccdd", ExtraNonce2Size: stratum.MaxExtraNonce2Size + 1}, "f000000f", 8, stratum.DeviationBadExtraNonce2, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sc := stratumtest.DefaultScenario()
+			sc.SetExtranonce = &tt.extranonce
+			sc.Jobs = []stratumtest.Job{testJob(t)}
+			srv := startServer(t, sc)
+			c := connect(t, srv, false)
+			handshake(t, c)
+
+			events := collect(t, c, isNotify)
+			n := lastNotify(t, events)
+			if n.ExtraNonce1 != tt.wantEN1 || n.ExtraNonce2Size != tt.wantSize {
+				t.Errorf("notify extranonce %s/%d, want %s/%d", n.ExtraNonce1, n.ExtraNonce2Size, tt.wantEN1, tt.wantSize)
+			}
+			var sawEvent bool
+			for _, ev := range events {
+				if ev, ok := ev.(stratum.ExtranonceEvent); ok {
+					sawEvent = ev.ExtraNonce1 == tt.wantEN1 && ev.ExtraNonce2Size == tt.wantSize
+				}
+			}
+			if sawEvent != tt.applied {
+				t.Errorf("extranonce event delivered: %v", sawEvent)
+			}
+			if got := strings.Join(deviationKinds(c), ","); got != tt.wantDev {
+				t.Errorf("deviations %q, want %q", got, tt.wantDev)
+			}
+		})
+	}
+}
+
+func TestClientSubscribeExtraNonce2Size(t *testing.T) {
+	tests := []struct {
+		size    int
+		wantDev string
+		fails   bool
+	}{
+		{0, stratum.DeviationZeroExtraNonce2, false},
+		{stratum.MaxExtraNonce2Size, "", false},
+		{stratum.MaxExtraNonce2Size + 1, stratum.DeviationBadExtraNonce2, true},
+		{-1, stratum.DeviationBadExtraNonce2, true},
+	}
+	for _, tt := range tests {
+		sc := stratumtest.DefaultScenario()
+		sc.ExtraNonce2Size = tt.size
+		srv := startServer(t, sc)
+		c := connect(t, srv, false)
+		err := c.Subscribe(context.Background(), "cgminer/4.10.0")
+		var protoErr *stratum.ProtocolError
+		if errors.As(err, &protoErr) != tt.fails {
+			t.Errorf("size %d: got %v, want failure %v", tt.size, err, tt.fails)
+		}
+		if !tt.fails && c.ExtraNonce2Size() != tt.size {
+			t.Errorf("size %d: client uses %d", tt.size, c.ExtraNonce2Size())
+		}
+		if got := strings.Join(deviationKinds(c), ","); got != tt.wantDev {
+			t.Errorf("size %d: deviations %q, want %q", tt.size, got, tt.wantDev)
+		}
+	}
+}
+
+func TestClientLimits(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*stratumtest.Scenario)
+		limits stratum.Limits
+		want   string
+	}{
+		{"oversized line", func(sc *stratumtest.Scenario) { sc.OversizedLine = 1 << 20 }, stratum.DefaultLimits(), stratum.LimitLineBytes},
+		{"flood", func(sc *stratumtest.Scenario) { sc.Flood = 5000 }, stratum.DefaultLimits(), stratum.LimitMessageRate},
+		{"session bytes", func(sc *stratumtest.Scenario) {
+			sc.Messages = []string{strings.Repeat("m", 900), strings.Repeat("m", 900)}
+		}, stratum.Limits{MaxSessionBytes: 2000}, stratum.LimitSessionBytes},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sc := stratumtest.DefaultScenario()
+			sc.Jobs = []stratumtest.Job{testJob(t)}
+			tt.modify(&sc)
+			srv := startServer(t, sc)
+			c := connect(t, srv, false, stratum.WithLimits(tt.limits))
+			handshake(t, c)
+
+			err := disconnectErr(t, collect(t, c, func(stratum.Event) bool { return false }))
+			var limitErr *stratum.LimitError
+			if !errors.As(err, &limitErr) || limitErr.Limit != tt.want {
+				t.Fatalf("disconnect error %v, want a %s limit", err, tt.want)
+			}
+			// Calls after the abort report the limit rather than a bare close.
+			if err := c.Authorize(context.Background()); !errors.Is(err, stratum.ErrLimitExceeded) {
+				t.Errorf("call after abort: %v", err)
+			}
+		})
+	}
+}
+
+func TestClientDisconnectAfter(t *testing.T) {
+	sc := stratumtest.DefaultScenario()
+	// The subscribe response and set_difficulty, then the server hangs up.
+	sc.DisconnectAfter = 2
+	sc.Jobs = []stratumtest.Job{testJob(t)}
+	srv := startServer(t, sc)
+	c := connect(t, srv, false)
+	if err := c.Subscribe(context.Background(), "cgminer/4.10.0"); err != nil {
+		t.Fatal(err)
+	}
+
+	events := collect(t, c, func(stratum.Event) bool { return false })
+	if err := disconnectErr(t, events); err == nil {
+		t.Fatal("remote hang-up reported as a local close")
+	}
+	if err := c.Authorize(context.Background()); !errors.Is(err, stratum.ErrConnectionClosed) {
+		t.Fatalf("authorize after hang-up: %v", err)
+	}
+}
+
+func TestClientLocalCloseEndsEvents(t *testing.T) {
+	srv := startServer(t, stratumtest.DefaultScenario())
+	c := connect(t, srv, false)
+	handshake(t, c)
+	c.Close()
+	for range c.Events() {
+	}
+	if err := c.Authorize(context.Background()); !errors.Is(err, stratum.ErrConnectionClosed) {
+		t.Fatalf("authorize after Close: %v", err)
+	}
+}
+
+func TestClientTLS(t *testing.T) {
+	sc := stratumtest.DefaultScenario()
+	job := testJob(t)
+	sc.Jobs = []stratumtest.Job{job}
+	srv, err := stratumtest.NewTLSServer(sc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(srv.Close)
+
+	untrusted := stratum.NewClient(srv.Host(), srv.Port(), "worker", "x", true)
+	defer untrusted.Close()
+	if err := untrusted.Connect(context.Background()); err == nil || !strings.Contains(err.Error(), "certificate") {
+		t.Fatalf("got %v, want a certificate error without the test roots", err)
+	}
+
+	c := connect(t, srv, true, stratum.WithTLSConfig(srv.ClientTLSConfig()))
+	handshake(t, c)
+	if n := lastNotify(t, collect(t, c, isNotify)); n.Params.CoinBase1 != job.CoinBase1 {
+		t.Errorf("notify %+v", n.Params)
+	}
+}
+
+// TestClientConcurrentWrites has the pool send the client requests while the
+// client sends its own, staying under the default message rate, then checks
+// the pool saw whole lines in exactly the order the transcript recorded them.
+func TestClientConcurrentWrites(t *testing.T) {
+	const requests, calls = 100, 40
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	wire := make(chan []string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			wire <- nil
+			return
+		}
+		defer conn.Close()
+		var writeMu sync.Mutex
+		write := func(line string) {
+			writeMu.Lock()
+			defer writeMu.Unlock()
+			_, _ = conn.Write([]byte(line + "\n"))
+		}
+		go func() {
+			for i := 0; i < requests; i++ {
+				write(fmt.Sprintf(`{"id":%d,"method":"client.get_version","params":[]}`, 1000+i))
+			}
+		}()
+		var lines []string
+		reader := bufio.NewReader(conn)
+		for len(lines) < requests+calls {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				break
+			}
+			line = strings.TrimRight(line, "\n")
+			lines = append(lines, line)
+			var req struct {
+				ID     int    `json:"id"`
+				Method string `json:"method"`
+			}
+			if json.Unmarshal([]byte(line), &req) == nil && req.Method == "mining.authorize" {
+				write(fmt.Sprintf(`{"id":%d,"result":true,"error":null}`, req.ID))
+			}
+		}
+		wire <- lines
+	}()
+
+	transcript := stratum.NewTranscript()
+	port := ln.Addr().(*net.TCPAddr).Port
+	c := stratum.NewClient("127.0.0.1", port, "worker", "x", false, stratum.WithTranscript(transcript))
+	t.Cleanup(c.Close)
+	if err := c.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var wg sync.WaitGroup
+	for i := 0; i < calls; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := c.Authorize(ctx); err != nil {
+				t.Errorf("authorize: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	var got []string
+	select {
+	case got = <-wire:
+	case <-time.After(10 * time.Second):
+		t.Fatal("pool did not receive every line")
+	}
+	for _, line := range got {
+		if !json.Valid([]byte(line)) {
+			t.Fatalf("pool received a torn line %q", line)
+		}
+	}
+	var sent []string
+	for _, l := range transcript.Lines() {
+		if l.Direction == stratum.DirectionSent {
+			sent = append(sent, l.Line)
+		}
+	}
+	if len(got) != requests+calls || strings.Join(got, "\n") != strings.Join(sent, "\n") {
+		t.Errorf("pool received %d lines out of transcript order (%d sent)", len(got), len(sent))
+	}
+}
@@ -5,16 +5,40 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"fmt"
+	"io"
 
 	"github.com/btcsuite/btcd/chaincfg"
-	"github.com/btcsuite/btcd/txscript"
 	"github.com/btcsuite/btcd/wire"
 )
 
 func DecodeCoinbaseParts(coinbase1, coinbase2, extraNonce1 string, extraNonce2Size int) (*CoinbaseInfo, error) {
+	return DecodeCoinbasePartsWith(DecodeOptions{}, coinbase1, coinbase2, extraNonce1, extraNonce2Size)
+}
+
+// DecodeOptions adjusts DecodeCoinbasePartsWith; zero fields use mainnet and
+// crypto/rand.
+type DecodeOptions struct {
+	// Params selects the network output addresses are encoded for.
+	Params *chaincfg.Params
+	// Rand supplies extranonce2, so callers can make it reproducible.
+	Rand io.Reader
+}
+
+// DecodeCoinbasePartsWith is DecodeCoinbaseParts with a chosen network and
+// extranonce2 source.
+func DecodeCoinbasePartsWith(opts DecodeOptions, coinbase1, coinbase2, extraNonce1 string, extraNonce2Size int) (*CoinbaseInfo, error) {
+	if opts.Params == nil {
+		opts.Params = &chaincfg.MainNetParams
+	}
+	if opts.Rand == nil {
+		opts.Rand = rand.Reader
+	}
+	if extraNonce2Size < 0 || extraNonce2Size > MaxExtraNonce2Size {
+		return nil, fmt.Errorf("extranonce2 size %d outside 0-%d", extraNonce2Size, MaxExtraNonce2Size)
+	}
 	extraNonce2Bytes := make([]byte, extraNonce2Size)
 	if extraNonce2Size > 0 {
-		if _, err := rand.Read(extraNonce2Bytes); err != nil {
+		if _, err := io.ReadFull(opts.Rand, extraNonce2Bytes); err != nil {
 			return nil, err
 		}
 	}
@@ -43,19 +67,48 @@ func DecodeCoinbaseParts(coinbase1, coinbase2, extraNonce1 string, extraNonce2Si
 		ExtraNonce2: extraNonce2,
 		ScriptSig:   scriptSig,
 	}
+	if len(tx.TxIn) == 1 {
+		start := scriptSigOffset(raw, &tx)
+		info.ScriptSigLayout, _ = DecodeScriptSig(scriptSig, len(coinbase1)/2-start, len(extraNonce1)/2, extraNonce2Size)
+		if info.ScriptSigLayout != nil {
+			info.ScriptSigLayout.Tags = append(info.ScriptSigLayout.Tags, coinbaseTags(raw[:start], &tx)...)
+		}
+	}
 
-	for _, out := range tx.TxOut {
-		scriptType, address := classifyOutput(out.PkScript)
-		info.Outputs = append(info.Outputs, CoinbaseOutput{
-			Address:    address,
-			ValueBTC:   float64(out.Value) / 1e8,
-			ScriptType: scriptType,
-		})
+	height, _ := parseBIP34Height(scriptSig)
+	info.Lint = LintCoinbase(&tx, height)
+	info.Commitments = scriptSigCommitments(scriptSig)
+	for i, out := range tx.TxOut {
+		if data := opReturnData(out.PkScript); data != nil {
+			protocol, payload := ClassifyCommitment(data)
+			info.Commitments = append(info.Commitments, Commitment{
+				Protocol:    protocol,
+				Source:      CommitmentInOutput,
+				OutputIndex: i,
+				Data:        data,
+				Payload:     payload,
+			})
+		}
+		output := classifyOutput(out.PkScript, opts.Params)
+		output.Value = out.Value
+		info.Outputs = append(info.Outputs, output)
 	}
 
 	return info, nil
 }
 
+// scriptSigOffset is where the first input's scriptSig starts in raw.
+func scriptSigOffset(raw []byte, tx *wire.MsgTx) int {
+	offset := 4
+	if len(raw) > 5 && raw[4] == 0x00 && raw[5] == 0x01 {
+		offset += 2 // segwit marker and flag
+	}
+	offset += wire.VarIntSerializeSize(uint64(len(tx.TxIn)))
+	offset += 36 // previous outpoint
+	offset += wire.VarIntSerializeSize(uint64(len(tx.TxIn[0].SignatureScript)))
+	return offset
+}
+
 func BuildFullCoinbase(coinbase1, extraNonce1, extraNonce2, coinbase2 string) (string, error) {
 	if _, err := hex.DecodeString(coinbase1); err != nil {
 		return "", fmt.Errorf("coinbase1: %w", err)
@@ -71,26 +124,3 @@ func BuildFullCoinbase(coinbase1, extraNonce1, extraNonce2, coinbase2 string) (s
 	}
 	return coinbase1 + extraNonce1 + extraNonce2 + coinbase2, nil
 }
-
-func classifyOutput(pkScript []byte) (scriptType, address string) {
-	if len(pkScript) >= 38 &&
-		pkScript[0] == txscript.OP_RETURN &&
-		pkScript[1] == 0x24 &&
-		pkScript[2] == 0xaa &&
-		pkScript[3] == 0x21 &&
-		pkScript[4] == 0xa9 &&
-		pkScript[5] == 0xed {
-		return "witness_commitment", ""
-	}
-
-	class := txscript.GetScriptClass(pkScript)
-	if class == txscript.NullDataTy {
-		return "OP_RETURN", ""
-	}
-
-	_, addrs, _, err := txscript.ExtractPkScriptAddrs(pkScript, &chaincfg.MainNetParams)
-	if err == nil && len(addrs) > 0 {
-		return class.String(), addrs[0].EncodeAddress()
-	}
-	return class.String(), ""
-}
@@ -0,0 +1,119 @@
+package stratum
+
+import (
+	"bytes"
+
+	"github.com/btcsuite/btcd/txscript"
+)
+
+// Commitment protocols recognized in coinbase OP_RETURN outputs and the
+// scriptSig.
+const (
+	CommitmentWitness = "witness"
+	CommitmentRSK     = "rsk"
+	// CommitmentAuxPoW is the merged-mining root of Namecoin-style chains
+	// (Namecoin, Syscoin, Elastos, ...); the chains themselves are hidden
+	// behind the root.
+	CommitmentAuxPoW  = "auxpow"
+	CommitmentCoreDAO = "coredao"
+	CommitmentHathor  = "hathor"
+	CommitmentStacks  = "stacks"
+	CommitmentOmni    = "omni"
+	CommitmentUnknown = "unknown"
+)
+
+// Where a commitment was found.
+const (
+	CommitmentInOutput    = "output"
+	CommitmentInScriptSig = "scriptsig"
+)
+
+// Commitment is one piece of data the coinbase commits to.
+type Commitment struct {
+	Protocol string
+	// Source is CommitmentInOutput or CommitmentInScriptSig.
+	Source string
+	// OutputIndex is the output carrying the commitment, or -1 for the
+	// scriptSig.
+	OutputIndex int
+	// Data is everything the output pushes, or the scriptSig from the tag on.
+	Data []byte
+	// Payload is Data with the protocol's tag removed.
+	Payload []byte
+}
+
+var (
+	witnessTag = []byte{0xaa, 0x21, 0xa9, 0xed}
+	rskTag     = []byte("RSKBLOCK:")
+	auxPoWTag  = []byte{0xfa, 0xbe, 'm', 'm'}
+	coreDAOTag = []byte("CORE")
+	hathorTag  = []byte("Hath")
+	stacksTag  = []byte("X2")
+	omniTag    = []byte("omni")
+)
+
+// commitmentTags are matched against the start of an OP_RETURN's data, most
+// specific first.
+var commitmentTags = []struct {
+	protocol string
+	tag      []byte
+}{
+	{CommitmentWitness, witnessTag},
+	{CommitmentRSK, rskTag},
+	{CommitmentAuxPoW, auxPoWTag},
+	{CommitmentCoreDAO, coreDAOTag},
+	{CommitmentHathor, hathorTag},
+	{CommitmentOmni, omniTag},
+	{CommitmentStacks, stacksTag},
+}
+
+// ClassifyCommitment names the protocol an OP_RETURN's data belongs to and
+// returns the data after its tag; unrecognized data is CommitmentUnknown.
+func ClassifyCommitment(data []byte) (protocol string, payload []byte) {
+	for _, t := range commitmentTags {
+		if bytes.HasPrefix(data, t.tag) {
+			return t.protocol, data[len(t.tag):]
+		}
+	}
+	return CommitmentUnknown, data
+}
+
+// opReturnData concatenates the pushes after OP_RETURN. Scripts that do not
+// parse, or hold opcodes rather than data, yield whatever bytes follow it.
+func opReturnData(pkScript []byte) []byte {
+	if len(pkScript) == 0 || pkScript[0] != txscript.OP_RETURN {
+		return nil
+	}
+	rest := pkScript[1:]
+	pushes, err := txscript.PushedData(rest)
+	data := bytes.Join(pushes, nil)
+	if err != nil || (len(data) == 0 && len(rest) > 0) {
+		return rest
+	}
+	if data == nil {
+		data = []byte{}
+	}
+	return data
+}
+
+// scriptSigCommitments finds merged-mining roots pools embed in the scriptSig
+// rather than in an output.
+func scriptSigCommitments(scriptSig []byte) []Commitment {
+	i := bytes.Index(scriptSig, auxPoWTag)
+	if i < 0 {
+		return nil
+	}
+	// The tag is followed by the 32-byte chain merkle root and the 4-byte
+	// tree size and nonce.
+	data := scriptSig[i:]
+	if len(data) > len(auxPoWTag)+40 {
+		data = data[:len(auxPoWTag)+40]
+	}
+	return []Commitment{{
+		Protocol:    CommitmentAuxPoW,
+		Source:      CommitmentInScriptSig,
+		OutputIndex: -1,
+		Data:        data,
+		Payload:     data[len(auxPoWTag):],
+	}}
+}
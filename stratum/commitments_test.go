@@ -0,0 +1,76 @@
+package stratum
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/btcsuite/btcd/txscript"
+)
+
+func TestClassifyCommitment(t *testing.T) {
+	root := bytes.Repeat([]byte{0x11}, 32)
+	tests := []struct {
+		protocol string
+		data     []byte
+		payload  []byte
+	}{
+		{CommitmentWitness, append([]byte{0xaa, 0x21, 0xa9, 0xed}, root...), root},
+		{CommitmentRSK, append([]byte("RSKBLOCK:"), root...), root},
+		{CommitmentAuxPoW, append([]byte{0xfa, 0xbe, 'm', 'm'}, root...), root},
+		{CommitmentCoreDAO, append([]byte("CORE"), root...), root},
+		{CommitmentHathor, append([]byte("Hath"), root...), root},
+		{CommitmentStacks, append([]byte("X2"), root...), root},
+		{CommitmentOmni, append([]byte("omni"), root...), root},
+		{CommitmentUnknown, []byte("hello"), []byte("hello")},
+		{CommitmentUnknown, nil, nil},
+	}
+	for _, tt := range tests {
+		protocol, payload := ClassifyCommitment(tt.data)
+		if protocol != tt.protocol || !bytes.Equal(payload, tt.payload) {
+			t.Errorf("%x: got %s %x, want %s %x", tt.data, protocol, payload, tt.protocol, tt.payload)
+		}
+	}
+}
+
+func TestOpReturnData(t *testing.T) {
+	tests := []struct {
+		name   string
+		script []byte
+		want   []byte
+	}{
+		{"not OP_RETURN", []byte{txscript.OP_0, txscript.OP_DATA_1, 0x01}, nil},
+		{"bare OP_RETURN", []byte{txscript.OP_RETURN}, []byte{}},
+		{"one push", []byte{txscript.OP_RETURN, txscript.OP_DATA_2, 'h', 'i'}, []byte("hi")},
+		{"two pushes", []byte{txscript.OP_RETURN, txscript.OP_DATA_1, 'a', txscript.OP_DATA_1, 'b'}, []byte("ab")},
+		{"truncated push", []byte{txscript.OP_RETURN, txscript.OP_DATA_4, 'a'}, []byte{txscript.OP_DATA_4, 'a'}},
+		{"opcodes", []byte{txscript.OP_RETURN, txscript.OP_DUP, txscript.OP_DROP}, []byte{txscript.OP_DUP, txscript.OP_DROP}},
+	}
+	for _, tt := range tests {
+		got := opReturnData(tt.script)
+		if !bytes.Equal(got, tt.want) || (got == nil) != (tt.want == nil) {
+			t.Errorf("%s: got %x, want %x", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestScriptSigCommitments(t *testing.T) {
+	root := bytes.Repeat([]byte{0x22}, 32)
+	aux := append(append([]byte{0xfa, 0xbe, 'm', 'm'}, root...), 1, 0, 0, 0, 0, 0, 0, 0)
+	scriptSig := append(append([]byte{0x03, 0x48, 0x1d, 0x0e, 0x2c}, aux...), "/pool/"...)
+
+	got := scriptSigCommitments(scriptSig)
+	if len(got) != 1 {
+		t.Fatalf("commitments %+v, want one", got)
+	}
+	c := got[0]
+	if c.Protocol != CommitmentAuxPoW || c.Source != CommitmentInScriptSig || c.OutputIndex != -1 {
+		t.Errorf("commitment %+v", c)
+	}
+	// The data stops after the root, tree size and nonce, before the tag.
+	if !bytes.Equal(c.Data, aux) || !bytes.Equal(c.Payload[:32], root) {
+		t.Errorf("data %x, want %x", c.Data, aux)
+	}
+	if got := scriptSigCommitments([]byte{0x03, 0x48, 0x1d, 0x0e}); got != nil {
+		t.Errorf("commitments %+v without the tag", got)
+	}
+}
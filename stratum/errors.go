@@ -0,0 +1,75 @@
+package stratum
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrNotConnected is returned by calls made before Connect.
+	ErrNotConnected = errors.New("stratum: not connected")
+	// ErrConnectionClosed is returned once the connection has ended, whether it
+	// dropped mid-call or Close was called.
+	ErrConnectionClosed = errors.New("stratum: connection closed")
+	// ErrAuthorizationRejected is returned when mining.authorize yields false.
+	ErrAuthorizationRejected = errors.New("stratum: authorization rejected")
+)
+
+// RPCError is an error object returned by the pool for a request.
+type RPCError struct {
+	Method  string
+	Code    int
+	Message string
+	// Raw is the error member exactly as decoded from JSON.
+	Raw any
+}
+
+func (e *RPCError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("%s: %v", e.Method, e.Raw)
+	}
+	if e.Code != 0 {
+		return fmt.Sprintf("%s: %s (code %d)", e.Method, e.Message, e.Code)
+	}
+	return fmt.Sprintf("%s: %s", e.Method, e.Message)
+}
+
+// ProtocolError is returned when a response is well formed JSON but not what
+// the Stratum V1 method promises.
+type ProtocolError struct {
+	Method string
+	Reason string
+}
+
+func (e *ProtocolError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Method, e.Reason)
+}
+
+// newRPCError decodes the usual [code, message, traceback] array, a
+// {"code","message"} object or a bare string.
+func newRPCError(method string, raw any) *RPCError {
+	e := &RPCError{Method: method, Raw: raw}
+	switch v := raw.(type) {
+	case []any:
+		if len(v) > 0 {
+			if code, ok := v[0].(float64); ok {
+				e.Code = int(code)
+			}
+		}
+		if len(v) > 1 {
+			if msg, ok := v[1].(string); ok {
+				e.Message = msg
+			}
+		}
+	case map[string]any:
+		if code, ok := v["code"].(float64); ok {
+			e.Code = int(code)
+		}
+		if msg, ok := v["message"].(string); ok {
+			e.Message = msg
+		}
+	case string:
+		e.Message = v
+	}
+	return e
+}
@@ -0,0 +1,48 @@
+package stratum
+
+import "time"
+
+// Event is a server notification delivered on Client.Events. The concrete
+// types are NotifyEvent, DifficultyEvent, ExtranonceEvent, MessageEvent and
+// DisconnectEvent.
+type Event interface {
+	isEvent()
+}
+
+// NotifyEvent carries a mining.notify together with the extranonce in effect
+// when it arrived, so the coinbase can be decoded without further calls.
+type NotifyEvent struct {
+	Params          *NotifyParams
+	ExtraNonce1     string
+	ExtraNonce2Size int
+	// Received is when the line was read, before any queueing delay.
+	Received time.Time
+}
+
+// DifficultyEvent is a mining.set_difficulty with a positive difficulty.
+type DifficultyEvent struct {
+	Difficulty float64
+}
+
+// ExtranonceEvent is a mining.set_extranonce after it has been applied.
+type ExtranonceEvent struct {
+	ExtraNonce1     string
+	ExtraNonce2Size int
+}
+
+// MessageEvent is a client.show_message.
+type MessageEvent struct {
+	Message string
+}
+
+// DisconnectEvent is the last event before the channel closes when the
+// connection drops. Err is nil after a local Close.
+type DisconnectEvent struct {
+	Err error
+}
+
+func (NotifyEvent) isEvent()     {}
+func (DifficultyEvent) isEvent() {}
+func (ExtranonceEvent) isEvent() {}
+func (MessageEvent) isEvent()    {}
+func (DisconnectEvent) isEvent() {}
@@ -0,0 +1,91 @@
+package stratum
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// HeaderSize is the length of a serialized block header.
+const HeaderSize = 80
+
+// MerkleRoot hashes the coinbase and folds it through the job's merkle
+// branch. The txid is taken from the stripped serialization, so a coinbase
+// sent with witness data still yields the root miners would commit to.
+func MerkleRoot(coinbaseHex string, branch []string) (chainhash.Hash, error) {
+	raw, err := hex.DecodeString(coinbaseHex)
+	if err != nil {
+		return chainhash.Hash{}, fmt.Errorf("coinbase: %w", err)
+	}
+	tx := wire.NewMsgTx(wire.TxVersion)
+	if err := tx.Deserialize(bytes.NewReader(raw)); err != nil {
+		return chainhash.Hash{}, fmt.Errorf("coinbase: %w", err)
+	}
+	root := tx.TxHash()
+	for i, h := range branch {
+		step, err := hex.DecodeString(h)
+		if err != nil || len(step) != chainhash.HashSize {
+			return chainhash.Hash{}, fmt.Errorf("merkle branch %d is not a 32-byte hash", i)
+		}
+		root = chainhash.DoubleHashH(append(root[:], step...))
+	}
+	return root, nil
+}
+
+// BuildHeader assembles the header a miner would hash for params with the
+// given full coinbase and a zero nonce.
+func BuildHeader(params *NotifyParams, coinbaseHex string) (*wire.BlockHeader, error) {
+	prev, err := chainhash.NewHashFromStr(params.PrevHash)
+	if err != nil || params.PrevHash == "" {
+		return nil, fmt.Errorf("prevhash is not a 32-byte hash")
+	}
+	version, err := parseHeaderWord("version", params.Version)
+	if err != nil {
+		return nil, err
+	}
+	bits, err := parseHeaderWord("nbits", params.NBits)
+	if err != nil {
+		return nil, err
+	}
+	ntime, err := parseHeaderWord("ntime", params.NTime)
+	if err != nil {
+		return nil, err
+	}
+	root, err := MerkleRoot(coinbaseHex, params.MerkleBranch)
+	if err != nil {
+		return nil, err
+	}
+	return &wire.BlockHeader{
+		Version:    int32(version),
+		PrevBlock:  *prev,
+		MerkleRoot: root,
+		Timestamp:  time.Unix(int64(ntime), 0),
+		Bits:       bits,
+	}, nil
+}
+
+// SerializeHeader returns the 80 header bytes in wire order.
+func SerializeHeader(h *wire.BlockHeader) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.Grow(HeaderSize)
+	if err := h.Serialize(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func parseHeaderWord(name, s string) (uint32, error) {
+	if s == "" {
+		return 0, fmt.Errorf("%s is missing", name)
+	}
+	v, err := strconv.ParseUint(s, 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("%s %q is not a 4-byte hex word", name, s)
+	}
+	return uint32(v), nil
+}
@@ -0,0 +1,124 @@
+package stratum
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Limits caps what a pool may send during one session. A zero field disables
+// that cap.
+type Limits struct {
+	// MaxLineBytes bounds a single JSON-RPC line, newline included.
+	MaxLineBytes int
+	// MaxMessagesPerSecond bounds received lines within any one-second window.
+	MaxMessagesPerSecond int
+	// MaxSessionBytes bounds everything received over the connection.
+	MaxSessionBytes int64
+}
+
+// DefaultLimits leaves ample room for real pools: a notify with a full merkle
+// branch and a large split coinbase is well under 64 KiB.
+func DefaultLimits() Limits {
+	return Limits{
+		MaxLineBytes:         256 << 10,
+		MaxMessagesPerSecond: 200,
+		MaxSessionBytes:      16 << 20,
+	}
+}
+
+// WithLimits replaces DefaultLimits for this client.
+func WithLimits(l Limits) Option {
+	return func(c *Client) {
+		c.limits = l
+	}
+}
+
+// MaxExtraNonce2Size is the largest extranonce2 a pool may ask miners to roll,
+// in bytes; real pools use 4 to 8.
+const MaxExtraNonce2Size = 32
+
+// validExtraNonce2Size reports whether size is a whole number of bytes from 0
+// to MaxExtraNonce2Size. Zero still works, leaving miners only ntime and the
+// version to roll, so callers record it as a deviation rather than fail.
+func validExtraNonce2Size(size float64) bool {
+	return size >= 0 && size <= MaxExtraNonce2Size && size == math.Trunc(size)
+}
+
+const (
+	LimitLineBytes    = "line_bytes"
+	LimitMessageRate  = "message_rate"
+	LimitSessionBytes = "session_bytes"
+)
+
+// ErrLimitExceeded matches any *LimitError with errors.Is.
+var ErrLimitExceeded = errors.New("stratum: limit exceeded")
+
+// LimitError reports the cap that made the client abort the session.
+type LimitError struct {
+	Limit string
+	Max   int64
+}
+
+func (e *LimitError) Error() string {
+	switch e.Limit {
+	case LimitLineBytes:
+		return fmt.Sprintf("stratum: line longer than %d bytes", e.Max)
+	case LimitMessageRate:
+		return fmt.Sprintf("stratum: more than %d messages per second", e.Max)
+	case LimitSessionBytes:
+		return fmt.Sprintf("stratum: session exceeded %d bytes", e.Max)
+	}
+	return fmt.Sprintf("stratum: %s limit %d exceeded", e.Limit, e.Max)
+}
+
+func (e *LimitError) Unwrap() error {
+	return ErrLimitExceeded
+}
+
+// limitedReader enforces Limits on the lines read by the read loop.
+type limitedReader struct {
+	r      *bufio.Reader
+	limits Limits
+
+	total       int64
+	windowStart time.Time
+	windowCount int
+}
+
+func (l *limitedReader) readLine() ([]byte, error) {
+	var out []byte
+	for {
+		chunk, err := l.r.ReadSlice('\n')
+		l.total += int64(len(chunk))
+		if l.limits.MaxSessionBytes > 0 && l.total > l.limits.MaxSessionBytes {
+			return nil, &LimitError{Limit: LimitSessionBytes, Max: l.limits.MaxSessionBytes}
+		}
+		if l.limits.MaxLineBytes > 0 && len(out)+len(chunk) > l.limits.MaxLineBytes {
+			return nil, &LimitError{Limit: LimitLineBytes, Max: int64(l.limits.MaxLineBytes)}
+		}
+		out = append(out, chunk...)
+		if err == nil {
+			break
+		}
+		if errors.Is(err, bufio.ErrBufferFull) {
+			continue
+		}
+		return nil, err
+	}
+
+	if l.limits.MaxMessagesPerSecond > 0 {
+		now := time.Now()
+		if now.Sub(l.windowStart) >= time.Second {
+			l.windowStart = now
+			l.windowCount = 0
+		}
+		l.windowCount++
+		if l.windowCount > l.limits.MaxMessagesPerSecond {
+			return nil, &LimitError{Limit: LimitMessageRate, Max: int64(l.limits.MaxMessagesPerSecond)}
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,162 @@
+package stratum
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// Lint severities, from a block nodes would reject down to a remark.
+const (
+	LintError   = "error"
+	LintWarning = "warning"
+	LintInfo    = "info"
+)
+
+// Lint rules.
+const (
+	LintInputs            = "inputs"
+	LintPrevOut           = "prevout"
+	LintLockTime          = "locktime"
+	LintVersion           = "version"
+	LintScriptSigSize     = "scriptsig_size"
+	LintHeight            = "bip34_height"
+	LintNoOutputs         = "no_outputs"
+	LintManyOutputs       = "many_outputs"
+	LintWitnessMissing    = "witness_commitment_missing"
+	LintWitnessMalformed  = "witness_commitment_malformed"
+	LintWitnessDuplicated = "witness_commitment_duplicated"
+	LintDust              = "dust_output"
+	LintNonStandard       = "nonstandard_output"
+	LintLargeOpReturn     = "large_op_return"
+	LintWeight            = "weight"
+	LintValueRange        = "value_range"
+)
+
+const (
+	// CoinbaseReservedWeight is Bitcoin Core's default -blockreservedweight;
+	// a heavier coinbase can push a full template over the block limit.
+	CoinbaseReservedWeight = 8000
+	// manyOutputs is where the output count starts to eat into block space.
+	manyOutputs = 100
+	// maxStandardOpReturn is the largest OP_RETURN script relayed by default
+	// before Bitcoin Core 30.
+	maxStandardOpReturn = 83
+	// dustRelayFee is Bitcoin Core's default dust relay fee in sat/kvB.
+	dustRelayFee = 3000
+)
+
+var witnessCommitmentPrefix = []byte{txscript.OP_RETURN, txscript.OP_DATA_36, 0xaa, 0x21, 0xa9, 0xed}
+
+// LintFinding is one structural problem with a coinbase transaction.
+type LintFinding struct {
+	Rule     string
+	Severity string
+	Message  string
+}
+
+// LintCoinbase checks the coinbase's structure against consensus rules and
+// what a block built on it needs. height is the BIP34 height, or 0 if the
+// scriptSig does not carry one.
+func LintCoinbase(tx *wire.MsgTx, height uint32) []LintFinding {
+	var findings []LintFinding
+	add := func(rule, severity, format string, args ...any) {
+		findings = append(findings, LintFinding{Rule: rule, Severity: severity, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if len(tx.TxIn) != 1 {
+		add(LintInputs, LintError, "coinbase has %d inputs; it must have exactly one", len(tx.TxIn))
+	}
+	if len(tx.TxIn) > 0 {
+		in := tx.TxIn[0]
+		if in.PreviousOutPoint.Hash != (chainhash.Hash{}) || in.PreviousOutPoint.Index != wire.MaxPrevOutIndex {
+			add(LintPrevOut, LintError, "input spends %s rather than the null prevout", in.PreviousOutPoint)
+		}
+		if n := len(in.SignatureScript); n < MinScriptSigLen || n > MaxScriptSigLen {
+			add(LintScriptSigSize, LintError, "scriptSig is %d bytes; consensus requires %d-%d", n, MinScriptSigLen, MaxScriptSigLen)
+		}
+		if height == 0 {
+			add(LintHeight, LintError, "scriptSig does not start with a BIP34 block height")
+		}
+		// A non-final coinbase is invalid until its locktime passes; heights
+		// and times are both compared against the block's height here, which
+		// is exact for heights and conservative for times.
+		if tx.LockTime != 0 && in.Sequence != wire.MaxTxInSequenceNum && (height == 0 || tx.LockTime >= height) {
+			add(LintLockTime, LintError, "locktime %d with sequence %08x makes the coinbase non-final", tx.LockTime, in.Sequence)
+		}
+	}
+	if tx.Version < 1 || tx.Version > 2 {
+		add(LintVersion, LintInfo, "transaction version %d is neither 1 nor 2", tx.Version)
+	}
+
+	switch n := len(tx.TxOut); {
+	case n == 0:
+		add(LintNoOutputs, LintError, "coinbase has no outputs")
+	case n > manyOutputs:
+		add(LintManyOutputs, LintWarning, "coinbase has %d outputs", n)
+	}
+
+	commitments := 0
+	var total int64
+	for i, out := range tx.TxOut {
+		// Same as Core's MoneyRange checks: every value and the running total
+		// must lie within the 21 million BTC supply.
+		switch {
+		case out.Value < 0 || out.Value > btcutil.MaxSatoshi:
+			add(LintValueRange, LintError, "output #%d pays %d sat, outside 0-%d", i, out.Value, int64(btcutil.MaxSatoshi))
+		case total <= btcutil.MaxSatoshi:
+			if total += out.Value; total > btcutil.MaxSatoshi {
+				add(LintValueRange, LintError, "outputs up to #%d pay more than %d sat in total", i, int64(btcutil.MaxSatoshi))
+			}
+		}
+		script := out.PkScript
+		isOpReturn := len(script) > 0 && script[0] == txscript.OP_RETURN
+		switch {
+		case len(script) >= 38 && bytes.HasPrefix(script, witnessCommitmentPrefix):
+			commitments++
+		case isOpReturn && bytes.Contains(script, witnessTag):
+			add(LintWitnessMalformed, LintError, "output #%d carries the witness commitment tag but not in BIP141's OP_RETURN OP_DATA_36 form", i)
+		}
+		if isOpReturn {
+			if len(script) > maxStandardOpReturn {
+				add(LintLargeOpReturn, LintInfo, "output #%d is a %d-byte OP_RETURN, above the long-standing %d-byte relay limit", i, len(script), maxStandardOpReturn)
+			}
+			continue
+		}
+		// Outputs to future witness versions are standard; spending them is not.
+		if version, _, ok := witnessProgram(script); txscript.GetScriptClass(script) == txscript.NonStandardTy && (!ok || version == 0) {
+			add(LintNonStandard, LintWarning, "output #%d pays a non-standard script", i)
+		}
+		if threshold := dustThreshold(out); out.Value < threshold {
+			add(LintDust, LintWarning, "output #%d pays %d sat, below the %d sat dust threshold", i, out.Value, threshold)
+		}
+	}
+	switch {
+	case commitments == 0:
+		add(LintWitnessMissing, LintWarning, "no witness commitment; a block including any segwit transaction would be invalid")
+	case commitments > 1:
+		add(LintWitnessDuplicated, LintWarning, "%d witness commitments; only the last one counts", commitments)
+	}
+
+	if weight := tx.SerializeSizeStripped()*3 + tx.SerializeSize(); weight > CoinbaseReservedWeight {
+		add(LintWeight, LintWarning, "coinbase weighs %d WU, more than the %d WU Bitcoin Core reserves for it", weight, CoinbaseReservedWeight)
+	}
+	return findings
+}
+
+// dustThreshold mirrors Bitcoin Core's GetDustThreshold: the output is dust
+// if spending it would cost more than a third of its value at the dust relay
+// fee.
+func dustThreshold(out *wire.TxOut) int64 {
+	size := int64(out.SerializeSize())
+	if txscript.IsWitnessProgram(out.PkScript) {
+		size += 32 + 4 + 1 + 107/4 + 4
+	} else {
+		size += 32 + 4 + 1 + 107 + 4
+	}
+	return size * dustRelayFee / 1000
+}
@@ -0,0 +1,114 @@
+package stratum_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+
+	"poolcensus/desktop/stratum"
+)
+
+const lintHeight = 925000
+
+// lintCoinbase returns a well-formed coinbase at lintHeight paying the
+// subsidy to a P2WPKH script, with a witness commitment.
+func lintCoinbase() *wire.MsgTx {
+	tx := wire.NewMsgTx(2)
+	tx.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: wire.OutPoint{Index: wire.MaxPrevOutIndex},
+		SignatureScript:  []byte{0x03, 0x48, 0x1d, 0x0e, 0x08, 1, 2, 3, 4, 5, 6, 7, 8},
+		Sequence:         wire.MaxTxInSequenceNum,
+	})
+	tx.AddTxOut(wire.NewTxOut(312500000, append([]byte{txscript.OP_0, txscript.OP_DATA_20}, make([]byte, 20)...)))
+	tx.AddTxOut(wire.NewTxOut(0, witnessCommitment()))
+	return tx
+}
+
+func witnessCommitment() []byte {
+	return append([]byte{txscript.OP_RETURN, txscript.OP_DATA_36, 0xaa, 0x21, 0xa9, 0xed}, bytes.Repeat([]byte{0x33}, 32)...)
+}
+
+func TestLintCoinbase(t *testing.T) {
+	p2wpkh := append([]byte{txscript.OP_0, txscript.OP_DATA_20}, make([]byte, 20)...)
+	tests := []struct {
+		name   string
+		modify func(tx *wire.MsgTx)
+		height uint32
+		want   string
+	}{
+		{"clean", func(tx *wire.MsgTx) {}, lintHeight, ""},
+		{"two inputs", func(tx *wire.MsgTx) { tx.AddTxIn(tx.TxIn[0]) }, lintHeight, stratum.LintInputs},
+		{"spends an outpoint", func(tx *wire.MsgTx) {
+			tx.TxIn[0].PreviousOutPoint = wire.OutPoint{Hash: chainhash.Hash{1}, Index: 0}
+		}, lintHeight, stratum.LintPrevOut},
+		{"scriptSig 1 byte", func(tx *wire.MsgTx) { tx.TxIn[0].SignatureScript = []byte{0x51} }, 1, stratum.LintScriptSigSize},
+		{"scriptSig 2 bytes", func(tx *wire.MsgTx) { tx.TxIn[0].SignatureScript = []byte{0x51, 0x00} }, 1, ""},
+		{"scriptSig 100 bytes", func(tx *wire.MsgTx) {
+			tx.TxIn[0].SignatureScript = append(tx.TxIn[0].SignatureScript, make([]byte, 100-13)...)
+		}, lintHeight, ""},
+		{"scriptSig 101 bytes", func(tx *wire.MsgTx) {
+			tx.TxIn[0].SignatureScript = append(tx.TxIn[0].SignatureScript, make([]byte, 101-13)...)
+		}, lintHeight, stratum.LintScriptSigSize},
+		{"no height", func(tx *wire.MsgTx) {}, 0, stratum.LintHeight},
+		{"non-final", func(tx *wire.MsgTx) {
+			tx.LockTime = lintHeight
+			tx.TxIn[0].Sequence = 0
+		}, lintHeight, stratum.LintLockTime},
+		{"final locktime", func(tx *wire.MsgTx) {
+			tx.LockTime = lintHeight - 1
+			tx.TxIn[0].Sequence = 0
+		}, lintHeight, ""},
+		{"version 3", func(tx *wire.MsgTx) { tx.Version = 3 }, lintHeight, stratum.LintVersion},
+		{"no outputs", func(tx *wire.MsgTx) { tx.TxOut = nil }, lintHeight, stratum.LintNoOutputs + "," + stratum.LintWitnessMissing},
+		{"many outputs", func(tx *wire.MsgTx) {
+			for i := 0; i < 100; i++ {
+				tx.AddTxOut(wire.NewTxOut(100000, p2wpkh))
+			}
+		}, lintHeight, stratum.LintManyOutputs + "," + stratum.LintWeight},
+		{"witness commitment missing", func(tx *wire.MsgTx) { tx.TxOut = tx.TxOut[:1] }, lintHeight, stratum.LintWitnessMissing},
+		{"witness commitment malformed", func(tx *wire.MsgTx) {
+			// The tag pushed on its own rather than as BIP141's 36-byte push.
+			tx.TxOut[1].PkScript = []byte{txscript.OP_RETURN, txscript.OP_DATA_4, 0xaa, 0x21, 0xa9, 0xed}
+		}, lintHeight, stratum.LintWitnessMalformed + "," + stratum.LintWitnessMissing},
+		{"witness commitment truncated", func(tx *wire.MsgTx) {
+			tx.TxOut[1].PkScript = witnessCommitment()[:37]
+		}, lintHeight, stratum.LintWitnessMalformed + "," + stratum.LintWitnessMissing},
+		{"witness commitment duplicated", func(tx *wire.MsgTx) {
+			tx.AddTxOut(wire.NewTxOut(0, witnessCommitment()))
+		}, lintHeight, stratum.LintWitnessDuplicated},
+		{"dust", func(tx *wire.MsgTx) { tx.AddTxOut(wire.NewTxOut(100, p2wpkh)) }, lintHeight, stratum.LintDust},
+		{"non-standard", func(tx *wire.MsgTx) {
+			tx.AddTxOut(wire.NewTxOut(100000, []byte{txscript.OP_TRUE}))
+		}, lintHeight, stratum.LintNonStandard},
+		{"future witness version", func(tx *wire.MsgTx) {
+			tx.AddTxOut(wire.NewTxOut(100000, append([]byte{txscript.OP_2, txscript.OP_DATA_32}, make([]byte, 32)...)))
+		}, lintHeight, ""},
+		{"large OP_RETURN", func(tx *wire.MsgTx) {
+			script, _ := txscript.NewScriptBuilder().AddOp(txscript.OP_RETURN).AddData(make([]byte, 100)).Script()
+			tx.AddTxOut(wire.NewTxOut(0, script))
+		}, lintHeight, stratum.LintLargeOpReturn},
+		{"negative value", func(tx *wire.MsgTx) { tx.TxOut[0].Value = -1 }, lintHeight, stratum.LintValueRange + "," + stratum.LintDust},
+		{"total above supply", func(tx *wire.MsgTx) {
+			tx.TxOut[0].Value = btcutil.MaxSatoshi
+			tx.AddTxOut(wire.NewTxOut(1000, p2wpkh))
+		}, lintHeight, stratum.LintValueRange},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tx := lintCoinbase()
+			tt.modify(tx)
+			var rules []string
+			for _, f := range stratum.LintCoinbase(tx, tt.height) {
+				rules = append(rules, f.Rule)
+			}
+			if got := strings.Join(rules, ","); got != tt.want {
+				t.Errorf("rules %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,224 @@
+package replay
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"poolcensus/desktop/stratum"
+)
+
+// Server replays a Session to every client that connects. Lines the pool sent
+// are written with the recorded spacing multiplied by Scale; lines the client
+// sent are awaited before the replay moves on. Job ntimes are rebased so the
+// first job carries the time of replay, keeping old captures from reading as
+// stale headers.
+type Server struct {
+	session *Session
+	scale   float64
+	ln      net.Listener
+
+	mu    sync.Mutex
+	conns []net.Conn
+	errs  []error
+	wg    sync.WaitGroup
+}
+
+// NewServer starts replaying session on a localhost port. A scale of 1 keeps
+// the original timing, 0 replays as fast as possible.
+func NewServer(session *Session, scale float64) (*Server, error) {
+	if scale < 0 {
+		return nil, errors.New("replay: negative scale")
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{session: session, scale: scale, ln: ln}
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+func (s *Server) Host() string {
+	host, _, _ := net.SplitHostPort(s.ln.Addr().String())
+	return host
+}
+
+func (s *Server) Port() int {
+	_, port, _ := net.SplitHostPort(s.ln.Addr().String())
+	p, _ := strconv.Atoi(port)
+	return p
+}
+
+// Errors returns replay failures, such as a client that diverged from the
+// recorded session.
+func (s *Server) Errors() []error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]error(nil), s.errs...)
+}
+
+func (s *Server) Close() {
+	_ = s.ln.Close()
+	s.mu.Lock()
+	for _, c := range s.conns {
+		_ = c.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.conns = append(s.conns, conn)
+		s.mu.Unlock()
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer conn.Close()
+			if err := s.play(conn); err != nil {
+				s.mu.Lock()
+				s.errs = append(s.errs, err)
+				s.mu.Unlock()
+			}
+		}()
+	}
+}
+
+func (s *Server) play(conn net.Conn) error {
+	reader := bufio.NewReader(conn)
+	// ids maps request ids in the recording to the ids the live client used.
+	ids := make(map[int]int)
+	prevOffset := 0.0
+	rebase := ntimeRebase{now: time.Now()}
+
+	for i, l := range s.session.Transcript {
+		delay := time.Duration((l.OffsetMs - prevOffset) * s.scale * float64(time.Millisecond))
+		prevOffset = l.OffsetMs
+
+		switch l.Direction {
+		case stratum.DirectionSent:
+			_ = conn.SetReadDeadline(time.Now().Add(30 * time.Second))
+			got, err := reader.ReadString('\n')
+			if err != nil {
+				return fmt.Errorf("replay: line %d: waiting for client: %w", i, err)
+			}
+			recordedID, okRecorded := messageID(l.Line)
+			liveID, okLive := messageID(got)
+			if okRecorded && okLive {
+				ids[recordedID] = liveID
+			}
+		case stratum.DirectionReceived:
+			if delay > 0 {
+				time.Sleep(delay)
+			}
+			line := rebase.apply(rewriteResponseID(l.Line, ids))
+			if _, err := conn.Write([]byte(line + "\n")); err != nil {
+				return fmt.Errorf("replay: line %d: %w", i, err)
+			}
+		default:
+			return fmt.Errorf("replay: line %d: unknown direction %q", i, l.Direction)
+		}
+	}
+
+	// Hold the connection open like a live pool until the client leaves.
+	_ = conn.SetReadDeadline(time.Time{})
+	_, _ = io.Copy(io.Discard, reader)
+	return nil
+}
+
+// ntimeRebase shifts every mining.notify ntime by the distance between now and
+// the first recorded job, so the spacing between jobs is kept.
+type ntimeRebase struct {
+	now   time.Time
+	shift int64
+	set   bool
+}
+
+// apply rewrites the ntime of a mining.notify line. Other lines, and notifies
+// whose ntime does not parse, pass unchanged.
+func (r *ntimeRebase) apply(line string) string {
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(line), &obj); err != nil {
+		return line
+	}
+	var method string
+	if err := json.Unmarshal(obj["method"], &method); err != nil || method != "mining.notify" {
+		return line
+	}
+	var params []json.RawMessage
+	if err := json.Unmarshal(obj["params"], &params); err != nil || len(params) < 8 {
+		return line
+	}
+	var ntimeHex string
+	if err := json.Unmarshal(params[7], &ntimeHex); err != nil {
+		return line
+	}
+	ntime, err := strconv.ParseUint(ntimeHex, 16, 32)
+	if err != nil {
+		return line
+	}
+	if !r.set {
+		r.shift = r.now.Unix() - int64(ntime)
+		r.set = true
+	}
+	rebased, _ := json.Marshal(fmt.Sprintf("%08x", uint32(int64(ntime)+r.shift)))
+	params[7] = rebased
+	if obj["params"], err = json.Marshal(params); err != nil {
+		return line
+	}
+	out, err := json.Marshal(obj)
+	if err != nil {
+		return line
+	}
+	return string(out)
+}
+
+func messageID(line string) (int, bool) {
+	var env struct {
+		ID *int `json:"id"`
+	}
+	if err := json.Unmarshal([]byte(line), &env); err != nil || env.ID == nil {
+		return 0, false
+	}
+	return *env.ID, true
+}
+
+// rewriteResponseID swaps a recorded response id for the live one. Lines that
+// are not JSON objects, carry a method, or have no mapped id pass unchanged.
+func rewriteResponseID(line string, ids map[int]int) string {
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(line), &obj); err != nil {
+		return line
+	}
+	if _, hasMethod := obj["method"]; hasMethod {
+		return line
+	}
+	id, ok := messageID(line)
+	if !ok {
+		return line
+	}
+	live, ok := ids[id]
+	if !ok || live == id {
+		return line
+	}
+	obj["id"] = json.RawMessage(strconv.Itoa(live))
+	out, err := json.Marshal(obj)
+	if err != nil {
+		return line
+	}
+	return string(out)
+}
@@ -0,0 +1,90 @@
+// Package replay plays captured stratum sessions back to a client on a local
+// port, so census logic can be exercised against real pool behaviour offline.
+package replay
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"poolcensus/desktop/stratum"
+)
+
+// Line mirrors one transcript line as stored in a census logEntry.
+type Line struct {
+	OffsetMs  float64 `json:"offset_ms"`
+	Direction string  `json:"direction"`
+	Line      string  `json:"line"`
+}
+
+// Session is a captured session. The JSON layout matches a census logEntry,
+// so a saved scan loads directly.
+type Session struct {
+	Host          string `json:"host"`
+	Port          int    `json:"port"`
+	UserAgent     string `json:"user_agent"`
+	Username      string `json:"username"`
+	WalletAddress string `json:"wallet_address"`
+	WorkerName    string `json:"worker_name"`
+	Transcript    []Line `json:"transcript"`
+}
+
+//go:embed sessions/*.json
+var canned embed.FS
+
+func Parse(data []byte) (*Session, error) {
+	var s Session
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("replay: %w", err)
+	}
+	if len(s.Transcript) == 0 {
+		return nil, fmt.Errorf("replay: session has no transcript")
+	}
+	return &s, nil
+}
+
+func Load(path string) (*Session, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// FromTranscript builds a session from a live client transcript.
+func FromTranscript(t *stratum.Transcript) *Session {
+	s := &Session{}
+	for _, l := range t.Lines() {
+		s.Transcript = append(s.Transcript, Line{
+			OffsetMs:  l.Offset.Seconds() * 1000.0,
+			Direction: l.Direction,
+			Line:      l.Line,
+		})
+	}
+	return s
+}
+
+// Canned loads one of the sessions shipped with the package by name, without
+// the .json suffix.
+func Canned(name string) (*Session, error) {
+	data, err := canned.ReadFile(path.Join("sessions", name+".json"))
+	if err != nil {
+		return nil, fmt.Errorf("replay: unknown canned session %q", name)
+	}
+	return Parse(data)
+}
+
+// CannedNames lists the sessions shipped with the package.
+func CannedNames() []string {
+	entries, _ := canned.ReadDir("sessions")
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, strings.TrimSuffix(e.Name(), ".json"))
+	}
+	sort.Strings(names)
+	return names
+}
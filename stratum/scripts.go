@@ -0,0 +1,125 @@
+package stratum
+
+import (
+	"bytes"
+	"encoding/hex"
+
+	"github.com/btcsuite/btcd/btcutil/bech32"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+)
+
+// Output script types, named after the address types that pay them where
+// there is one.
+const (
+	ScriptP2PKH  = "p2pkh"
+	ScriptP2SH   = "p2sh"
+	ScriptP2WPKH = "p2wpkh"
+	ScriptP2WSH  = "p2wsh"
+	ScriptP2TR   = "p2tr"
+	// ScriptWitnessUnknown is a witness program of a version no soft fork
+	// has defined yet; anyone can spend it until one does.
+	ScriptWitnessUnknown    = "witness_unknown"
+	ScriptP2PK              = "p2pk"
+	ScriptMultisig          = "multisig"
+	ScriptWitnessCommitment = "witness_commitment"
+	ScriptOpReturn          = "OP_RETURN"
+	ScriptNonStandard       = "nonstandard"
+)
+
+// addressScriptTypes maps the script classes that encode as an address.
+var addressScriptTypes = map[txscript.ScriptClass]string{
+	txscript.PubKeyHashTy:          ScriptP2PKH,
+	txscript.ScriptHashTy:          ScriptP2SH,
+	txscript.WitnessV0PubKeyHashTy: ScriptP2WPKH,
+	txscript.WitnessV0ScriptHashTy: ScriptP2WSH,
+	txscript.WitnessV1TaprootTy:    ScriptP2TR,
+}
+
+// classifyOutput describes what pkScript pays; the caller fills in Value.
+func classifyOutput(pkScript []byte, params *chaincfg.Params) CoinbaseOutput {
+	out := CoinbaseOutput{PkScript: pkScript}
+
+	// Oversized or non-push OP_RETURN scripts are nonstandard to the script
+	// classifier but just as unspendable.
+	if len(pkScript) > 0 && pkScript[0] == txscript.OP_RETURN {
+		out.ScriptType = ScriptOpReturn
+		if len(pkScript) >= 38 && bytes.HasPrefix(pkScript, witnessCommitmentPrefix) {
+			out.ScriptType = ScriptWitnessCommitment
+		}
+		out.Asm = disasm(pkScript)
+		out.Unspendable = true
+		return out
+	}
+
+	class, addrs, required, err := txscript.ExtractPkScriptAddrs(pkScript, params)
+	if err != nil {
+		class = txscript.NonStandardTy
+	}
+	switch class {
+	case txscript.PubKeyHashTy, txscript.ScriptHashTy, txscript.WitnessV0PubKeyHashTy, txscript.WitnessV0ScriptHashTy, txscript.WitnessV1TaprootTy:
+		out.ScriptType = addressScriptTypes[class]
+		if len(addrs) > 0 {
+			out.Address = addrs[0].EncodeAddress()
+		}
+	case txscript.PubKeyTy, txscript.MultiSigTy:
+		out.ScriptType = ScriptP2PK
+		if class == txscript.MultiSigTy {
+			out.ScriptType = ScriptMultisig
+		}
+		keys, _ := txscript.PushedData(pkScript)
+		for _, key := range keys {
+			out.PubKeys = append(out.PubKeys, hex.EncodeToString(key))
+		}
+		out.RequiredSigs = required
+		// Only keys that parse as curve points are returned as addresses;
+		// with fewer of them than required signatures nothing can sign.
+		out.Unspendable = len(addrs) < required
+		out.Asm = disasm(pkScript)
+	default:
+		out.ScriptType = ScriptNonStandard
+		if version, program, ok := witnessProgram(pkScript); ok && version > 0 {
+			out.ScriptType = ScriptWitnessUnknown
+			out.Address = encodeWitnessAddress(params, version, program)
+		} else if ok {
+			// Version 0 programs other than P2WPKH and P2WSH fail BIP141.
+			out.Unspendable = true
+		} else {
+			out.Unspendable = txscript.IsUnspendable(pkScript)
+		}
+		out.Asm = disasm(pkScript)
+	}
+	return out
+}
+
+// witnessProgram splits a witness output script into version and program.
+func witnessProgram(pkScript []byte) (byte, []byte, bool) {
+	if !txscript.IsWitnessProgram(pkScript) {
+		return 0, nil, false
+	}
+	version, program, err := txscript.ExtractWitnessProgramInfo(pkScript)
+	if err != nil {
+		return 0, nil, false
+	}
+	return byte(version), program, true
+}
+
+// encodeWitnessAddress encodes a future-version witness program as a bech32m
+// address, which btcutil only does for versions it knows.
+func encodeWitnessAddress(params *chaincfg.Params, version byte, program []byte) string {
+	data, err := bech32.ConvertBits(program, 8, 5, true)
+	if err != nil {
+		return ""
+	}
+	addr, err := bech32.EncodeM(params.Bech32HRPSegwit, append([]byte{version}, data...))
+	if err != nil {
+		return ""
+	}
+	return addr
+}
+
+// disasm disassembles script, keeping whatever parsed before an error.
+func disasm(script []byte) string {
+	asm, _ := txscript.DisasmString(script)
+	return asm
+}
@@ -0,0 +1,85 @@
+package stratum
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+)
+
+func TestClassifyOutput(t *testing.T) {
+	key := func(b byte) []byte {
+		priv, _ := btcec.PrivKeyFromBytes(bytes.Repeat([]byte{b}, 32))
+		return priv.PubKey().SerializeCompressed()
+	}
+	// A 33-byte push shaped like a compressed key that is not on the curve.
+	badKey := append([]byte{0x02}, bytes.Repeat([]byte{0xff}, 32)...)
+	hash20 := bytes.Repeat([]byte{0x11}, 20)
+	hash32 := bytes.Repeat([]byte{0x22}, 32)
+	build := func(b *txscript.ScriptBuilder) []byte {
+		script, err := b.Script()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return script
+	}
+	multisig := func(required int, keys ...[]byte) []byte {
+		b := txscript.NewScriptBuilder().AddInt64(int64(required))
+		for _, k := range keys {
+			b.AddData(k)
+		}
+		return build(b.AddInt64(int64(len(keys))).AddOp(txscript.OP_CHECKMULTISIG))
+	}
+
+	tests := []struct {
+		name        string
+		script      []byte
+		scriptType  string
+		address     string
+		unspendable bool
+		required    int
+		pubKeys     int
+	}{
+		{"p2pkh", build(txscript.NewScriptBuilder().AddOp(txscript.OP_DUP).AddOp(txscript.OP_HASH160).AddData(hash20).AddOp(txscript.OP_EQUALVERIFY).AddOp(txscript.OP_CHECKSIG)), ScriptP2PKH, "1", false, 0, 0},
+		{"p2sh", build(txscript.NewScriptBuilder().AddOp(txscript.OP_HASH160).AddData(hash20).AddOp(txscript.OP_EQUAL)), ScriptP2SH, "3", false, 0, 0},
+		{"p2wpkh", append([]byte{txscript.OP_0, txscript.OP_DATA_20}, hash20...), ScriptP2WPKH, "bc1q", false, 0, 0},
+		{"p2wsh", append([]byte{txscript.OP_0, txscript.OP_DATA_32}, hash32...), ScriptP2WSH, "bc1q", false, 0, 0},
+		{"p2tr", append([]byte{txscript.OP_1, txscript.OP_DATA_32}, key(1)[1:]...), ScriptP2TR, "bc1p", false, 0, 0},
+		{"witness v2", append([]byte{txscript.OP_2, txscript.OP_DATA_32}, hash32...), ScriptWitnessUnknown, "bc1z", false, 0, 0},
+		{"witness v0 of 25 bytes", append([]byte{txscript.OP_0, 25}, bytes.Repeat([]byte{0x33}, 25)...), ScriptNonStandard, "", true, 0, 0},
+		{"p2pk", build(txscript.NewScriptBuilder().AddData(key(1)).AddOp(txscript.OP_CHECKSIG)), ScriptP2PK, "", false, 1, 1},
+		{"p2pk off the curve", build(txscript.NewScriptBuilder().AddData(badKey).AddOp(txscript.OP_CHECKSIG)), ScriptP2PK, "", true, 1, 1},
+		{"multisig 1-of-2", multisig(1, key(1), key(2)), ScriptMultisig, "", false, 1, 2},
+		{"multisig 2-of-2 with a bad key", multisig(2, key(1), badKey), ScriptMultisig, "", true, 2, 2},
+		{"nonstandard", []byte{txscript.OP_TRUE}, ScriptNonStandard, "", false, 0, 0},
+		{"unparseable", []byte{txscript.OP_DATA_4, 0x01}, ScriptNonStandard, "", true, 0, 0},
+		{"OP_RETURN", []byte{txscript.OP_RETURN, txscript.OP_DATA_2, 'h', 'i'}, ScriptOpReturn, "", true, 0, 0},
+		{"witness commitment", append(append([]byte(nil), witnessCommitmentPrefix...), hash32...), ScriptWitnessCommitment, "", true, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := classifyOutput(tt.script, &chaincfg.MainNetParams)
+			if out.ScriptType != tt.scriptType || out.Unspendable != tt.unspendable {
+				t.Errorf("%s unspendable=%v, want %s unspendable=%v", out.ScriptType, out.Unspendable, tt.scriptType, tt.unspendable)
+			}
+			if (tt.address == "") != (out.Address == "") || !strings.HasPrefix(out.Address, tt.address) {
+				t.Errorf("address %q, want prefix %q", out.Address, tt.address)
+			}
+			if out.RequiredSigs != tt.required || len(out.PubKeys) != tt.pubKeys {
+				t.Errorf("%d of %d keys, want %d of %d", out.RequiredSigs, len(out.PubKeys), tt.required, tt.pubKeys)
+			}
+			for _, k := range out.PubKeys {
+				if len(k) != 66 || !strings.Contains(hex.EncodeToString(tt.script), k) {
+					t.Errorf("key %s not pushed by the script", k)
+				}
+			}
+			if !bytes.Equal(out.PkScript, tt.script) || (out.Address == "" && out.Asm == "") {
+				t.Errorf("script %x asm %q", out.PkScript, out.Asm)
+			}
+		})
+	}
+}
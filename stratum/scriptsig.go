@@ -1,6 +1,12 @@
 package stratum
 
-import "encoding/binary"
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
 
 func ParseScriptSig(scriptSig []byte) map[string]any {
 	out := make(map[string]any)
@@ -15,6 +21,10 @@ func parseBIP34Height(scriptSig []byte) (uint32, bool) {
 	if len(scriptSig) == 0 {
 		return 0, false
 	}
+	// Heights 1-16 are encoded as OP_1..OP_16 (BIP34 uses CScriptNum).
+	if op := scriptSig[0]; op >= txscript.OP_1 && op <= txscript.OP_16 {
+		return uint32(op-txscript.OP_1) + 1, true
+	}
 	pushLen := int(scriptSig[0])
 	if pushLen == 0 || pushLen > 5 || len(scriptSig) < 1+pushLen {
 		return 0, false
@@ -38,3 +48,187 @@ func parseBIP34Height(scriptSig []byte) (uint32, bool) {
 	return height, true
 }
 
+// Consensus bounds on the coinbase scriptSig length.
+const (
+	MinScriptSigLen = 2
+	MaxScriptSigLen = 100
+)
+
+const (
+	PushRoleHeight     = "height"
+	PushRoleExtraNonce = "extranonce"
+	PushRolePool       = "pool"
+
+	OpcodeUnparsed = "unparsed"
+)
+
+// ScriptSigPush is one opcode of a coinbase scriptSig.
+type ScriptSigPush struct {
+	Offset int
+	Opcode string
+	Data   []byte
+	Role   string
+}
+
+// Fields a ScriptSigTag can be found in, besides "output N".
+const (
+	TagFieldScriptSig   = "scriptSig"
+	TagFieldTransaction = "transaction"
+	TagFieldWitness     = "witness"
+)
+
+// ScriptSigTag is a printable run found in the coinbase. Source is
+// "coinbase1" or "coinbase2", whichever carried those bytes, and Field where
+// in the transaction they sit: the scriptSig, an output script such as an
+// OP_RETURN, the witness, or the transaction bytes before the scriptSig.
+type ScriptSigTag struct {
+	Source string
+	Field  string
+	Text   string
+}
+
+// ScriptSigLayout splits a coinbase scriptSig into the BIP34 height, the
+// pool's own bytes and the miner-controlled extranonce region.
+type ScriptSigLayout struct {
+	Length    int
+	Height    uint32
+	HasHeight bool
+
+	// Prefix comes from coinbase1, Suffix from coinbase2.
+	Prefix      []byte
+	ExtraNonce1 []byte
+	ExtraNonce2 []byte
+	Suffix      []byte
+
+	// Pushes ends with an OpcodeUnparsed chunk when the scriptSig stops
+	// parsing as a script, which consensus allows for coinbases. Tags come
+	// from Prefix and Suffix, then from the rest of the coinbase once
+	// DecodeCoinbaseParts adds them.
+	Pushes     []ScriptSigPush
+	Tags       []ScriptSigTag
+	Violations []string
+}
+
+// minTagLen is the shortest printable run reported as a tag.
+const minTagLen = 4
+
+// DecodeScriptSig splits scriptSig around the extranonce, which starts at
+// extraNonceOffset and spans len1+len2 bytes.
+func DecodeScriptSig(scriptSig []byte, extraNonceOffset, len1, len2 int) (*ScriptSigLayout, error) {
+	end := extraNonceOffset + len1 + len2
+	if extraNonceOffset < 0 || end > len(scriptSig) {
+		return nil, fmt.Errorf("extranonce region %d..%d outside scriptSig of %d bytes", extraNonceOffset, end, len(scriptSig))
+	}
+	layout := &ScriptSigLayout{
+		Length:      len(scriptSig),
+		Prefix:      scriptSig[:extraNonceOffset],
+		ExtraNonce1: scriptSig[extraNonceOffset : extraNonceOffset+len1],
+		ExtraNonce2: scriptSig[extraNonceOffset+len1 : end],
+		Suffix:      scriptSig[end:],
+	}
+	layout.Height, layout.HasHeight = parseBIP34Height(scriptSig)
+
+	if len(scriptSig) < MinScriptSigLen || len(scriptSig) > MaxScriptSigLen {
+		layout.Violations = append(layout.Violations, fmt.Sprintf("scriptSig is %d bytes; consensus requires %d-%d", len(scriptSig), MinScriptSigLen, MaxScriptSigLen))
+	}
+	if !layout.HasHeight {
+		layout.Violations = append(layout.Violations, "scriptSig does not start with a BIP34 block height")
+	}
+
+	layout.Pushes = tokenizeScriptSig(scriptSig, extraNonceOffset, end, layout.HasHeight)
+	layout.Tags = append(layout.Tags, printableRuns("coinbase1", TagFieldScriptSig, layout.Prefix)...)
+	layout.Tags = append(layout.Tags, printableRuns("coinbase2", TagFieldScriptSig, layout.Suffix)...)
+	return layout, nil
+}
+
+// coinbaseTags returns the printable runs outside the scriptSig: in head,
+// the transaction bytes coinbase1 carries before it, and in every output
+// script and the witness, which coinbase2 carries. Amounts, sequence and
+// locktime are skipped so numbers cannot pass for text.
+func coinbaseTags(head []byte, tx *wire.MsgTx) []ScriptSigTag {
+	tags := printableRuns("coinbase1", TagFieldTransaction, head)
+	for i, out := range tx.TxOut {
+		tags = append(tags, printableRuns("coinbase2", fmt.Sprintf("output %d", i), out.PkScript)...)
+	}
+	if len(tx.TxIn) > 0 {
+		for _, item := range tx.TxIn[0].Witness {
+			tags = append(tags, printableRuns("coinbase2", TagFieldWitness, item)...)
+		}
+	}
+	return tags
+}
+
+func tokenizeScriptSig(scriptSig []byte, enStart, enEnd int, hasHeight bool) []ScriptSigPush {
+	var pushes []ScriptSigPush
+	tok := txscript.MakeScriptTokenizer(0, scriptSig)
+	offset := 0
+	for tok.Next() {
+		next := int(tok.ByteIndex())
+		push := ScriptSigPush{
+			Offset: offset,
+			Opcode: opcodeName(tok.Opcode()),
+			Data:   tok.Data(),
+			Role:   PushRolePool,
+		}
+		switch {
+		case offset == 0 && hasHeight:
+			push.Role = PushRoleHeight
+		case offset < enEnd && next > enStart:
+			push.Role = PushRoleExtraNonce
+		}
+		pushes = append(pushes, push)
+		offset = next
+	}
+	if tok.Err() != nil && offset < len(scriptSig) {
+		// Consensus does not require the coinbase scriptSig to parse; keep
+		// what did and report the rest as one raw chunk.
+		rest := ScriptSigPush{Offset: offset, Opcode: OpcodeUnparsed, Data: scriptSig[offset:], Role: PushRolePool}
+		if offset < enEnd && len(scriptSig) > enStart {
+			rest.Role = PushRoleExtraNonce
+		}
+		pushes = append(pushes, rest)
+	}
+	return pushes
+}
+
+// opcodeNames inverts txscript.OpcodeByName, preferring the canonical
+// OP_DATA_n/OP_n spellings over aliases such as OP_FALSE and OP_TRUE.
+var opcodeNames = func() map[byte]string {
+	names := make(map[byte]string, len(txscript.OpcodeByName))
+	for name, op := range txscript.OpcodeByName {
+		if existing, ok := names[op]; !ok || len(name) < len(existing) || (len(name) == len(existing) && name < existing) {
+			names[op] = name
+		}
+	}
+	return names
+}()
+
+func opcodeName(op byte) string {
+	if name, ok := opcodeNames[op]; ok {
+		return name
+	}
+	return fmt.Sprintf("0x%02x", op)
+}
+
+// printableRuns returns every run of at least minTagLen printable ASCII bytes.
+func printableRuns(source, field string, b []byte) []ScriptSigTag {
+	var tags []ScriptSigTag
+	start := -1
+	flush := func(end int) {
+		if start >= 0 && end-start >= minTagLen {
+			tags = append(tags, ScriptSigTag{Source: source, Field: field, Text: string(b[start:end])})
+		}
+		start = -1
+	}
+	for i, c := range b {
+		if c >= 0x20 && c <= 0x7e {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		flush(i)
+	}
+	flush(len(b))
+	return tags
+}
@@ -0,0 +1,118 @@
+package stratum_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+
+	"poolcensus/desktop/stratum"
+	"poolcensus/desktop/stratum/stratumtest"
+)
+
+func TestDecodeCoinbaseTagsOutsideScriptSig(t *testing.T) {
+	pkScript := append([]byte{0x00, 0x14}, make([]byte, 20)...)
+	opReturn, err := txscript.NullDataScript([]byte("Mined by /ExamplePool/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c1, c2, err := stratumtest.BuildCoinbase(925000, "/stratumtest/", 12, []*wire.TxOut{
+		wire.NewTxOut(312500000, pkScript),
+		wire.NewTxOut(0, opReturn),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := stratum.DecodeCoinbaseParts(c1, c2, "f000000f", 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.ScriptSigLayout == nil {
+		t.Fatal("no scriptSig layout")
+	}
+	want := []stratum.ScriptSigTag{
+		{Source: "coinbase2", Field: stratum.TagFieldScriptSig, Text: "/stratumtest/"},
+		{Source: "coinbase2", Field: "output 1", Text: "Mined by /ExamplePool/"},
+	}
+	got := info.ScriptSigLayout.Tags
+	if len(got) != len(want) {
+		t.Fatalf("tags %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("tag %d: %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestDecodeScriptSig(t *testing.T) {
+	height925000 := []byte{0x03, 0x48, 0x1d, 0x0e}
+	padded := func(prefix []byte, n int) []byte {
+		return append(append([]byte(nil), prefix...), bytes.Repeat([]byte{0xaa}, n-len(prefix))...)
+	}
+	tests := []struct {
+		name      string
+		script    []byte
+		height    uint32
+		hasHeight bool
+		violation string
+	}{
+		{"OP_1", []byte{0x51, 0xaa}, 1, true, ""},
+		{"OP_16", []byte{0x60, 0xaa}, 16, true, ""},
+		{"one byte push", []byte{0x01, 0x11}, 17, true, ""},
+		{"three byte push", height925000, 925000, true, ""},
+		{"four byte push", []byte{0x04, 0x00, 0x00, 0x00, 0x01}, 1 << 24, true, ""},
+		{"five byte push", []byte{0x05, 0x01, 0x00, 0x00, 0x00, 0x00}, 1, true, ""},
+		{"OP_0", []byte{0x00, 0xaa}, 0, false, "BIP34"},
+		{"six byte push", []byte{0x06, 1, 2, 3, 4, 5, 6}, 0, false, "BIP34"},
+		{"truncated push", []byte{0x03, 0x48}, 0, false, "BIP34"},
+		{"one byte", []byte{0x51}, 1, true, "scriptSig is 1 bytes"},
+		{"two bytes", []byte{0x01, 0x11}, 17, true, ""},
+		{"100 bytes", padded(height925000, stratum.MaxScriptSigLen), 925000, true, ""},
+		{"101 bytes", padded(height925000, stratum.MaxScriptSigLen+1), 925000, true, "scriptSig is 101 bytes"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			layout, err := stratum.DecodeScriptSig(tt.script, len(tt.script), 0, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if layout.Height != tt.height || layout.HasHeight != tt.hasHeight {
+				t.Errorf("height %d (%v), want %d (%v)", layout.Height, layout.HasHeight, tt.height, tt.hasHeight)
+			}
+			violations := strings.Join(layout.Violations, "; ")
+			if (tt.violation == "") != (violations == "") || !strings.Contains(violations, tt.violation) {
+				t.Errorf("violations %q, want %q", violations, tt.violation)
+			}
+		})
+	}
+}
+
+func TestDecodeScriptSigExtranonce(t *testing.T) {
+	// height, a 4+2 byte extranonce push, then the pool's tag.
+	script := []byte{0x03, 0x48, 0x1d, 0x0e, 0x06, 1, 2, 3, 4, 5, 6, '/', 'p', 'o', 'o', 'l', '/'}
+	layout, err := stratum.DecodeScriptSig(script, 5, 4, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(layout.ExtraNonce1, []byte{1, 2, 3, 4}) || !bytes.Equal(layout.ExtraNonce2, []byte{5, 6}) || string(layout.Suffix) != "/pool/" {
+		t.Errorf("layout %+v", layout)
+	}
+	var roles []string
+	for _, push := range layout.Pushes {
+		roles = append(roles, push.Role)
+	}
+	// "/" reads as OP_DATA_47, so the tag is kept as one unparsed chunk.
+	if got := strings.Join(roles, ","); got != "height,extranonce,pool" || layout.Pushes[2].Opcode != stratum.OpcodeUnparsed {
+		t.Errorf("push roles %s, pushes %+v", got, layout.Pushes)
+	}
+	if len(layout.Tags) != 1 || layout.Tags[0] != (stratum.ScriptSigTag{Source: "coinbase2", Field: stratum.TagFieldScriptSig, Text: "/pool/"}) {
+		t.Errorf("tags %+v", layout.Tags)
+	}
+
+	if _, err := stratum.DecodeScriptSig(script, 15, 4, 2); err == nil {
+		t.Error("extranonce region past the end of the scriptSig decoded without error")
+	}
+}
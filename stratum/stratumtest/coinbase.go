@@ -0,0 +1,52 @@
+package stratumtest
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// BuildCoinbase serializes a coinbase for height with the given outputs and
+// splits it around an extranonce of extranonceSize bytes (extranonce1 plus
+// extranonce2), returning the coinbase1/coinbase2 pair for a Job.
+func BuildCoinbase(height int64, tag string, extranonceSize int, outputs []*wire.TxOut) (string, string, error) {
+	if extranonceSize <= 0 || extranonceSize > 75 {
+		return "", "", errors.New("stratumtest: extranonce size out of range")
+	}
+	heightPush, err := txscript.NewScriptBuilder().AddInt64(height).Script()
+	if err != nil {
+		return "", "", err
+	}
+	scriptSig := append([]byte(nil), heightPush...)
+	scriptSig = append(scriptSig, byte(extranonceSize))
+	prefixLen := len(scriptSig)
+	scriptSig = append(scriptSig, make([]byte, extranonceSize)...)
+	scriptSig = append(scriptSig, tag...)
+
+	tx := wire.NewMsgTx(2)
+	tx.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: wire.OutPoint{Hash: chainhash.Hash{}, Index: wire.MaxPrevOutIndex},
+		SignatureScript:  scriptSig,
+		Sequence:         wire.MaxTxInSequenceNum,
+	})
+	for _, out := range outputs {
+		tx.AddTxOut(out)
+	}
+
+	var buf bytes.Buffer
+	if err := tx.SerializeNoWitness(&buf); err != nil {
+		return "", "", err
+	}
+	raw := buf.Bytes()
+	// version(4) + input count(1) + outpoint(36) + script length varint(1 while
+	// the script is under 253 bytes) precede the scriptSig.
+	if len(scriptSig) >= 0xfd {
+		return "", "", errors.New("stratumtest: scriptSig too long")
+	}
+	split := 4 + 1 + 36 + 1 + prefixLen
+	return hex.EncodeToString(raw[:split]), hex.EncodeToString(raw[split+extranonceSize:]), nil
+}
@@ -0,0 +1,352 @@
+// Package stratumtest provides a scriptable in-process Stratum V1 pool for
+// integration tests of stratum.Client and the census logic built on it.
+package stratumtest
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Job is one mining.notify sent by the server.
+type Job struct {
+	ID           string
+	PrevHash     string
+	CoinBase1    string
+	CoinBase2    string
+	MerkleBranch []string
+	Version      string
+	NBits        string
+	NTime        string
+	Clean        bool
+}
+
+// Extranonce is a mining.set_extranonce sent after authorization.
+type Extranonce struct {
+	ExtraNonce1     string
+	ExtraNonce2Size int
+}
+
+// Scenario scripts how the server behaves towards every connection.
+type Scenario struct {
+	ExtraNonce1     string
+	ExtraNonce2Size int
+	Difficulty      float64
+
+	// SubscribeDelay holds the mining.subscribe response back.
+	SubscribeDelay time.Duration
+	// GarbageLines are written verbatim right after the subscribe response.
+	GarbageLines []string
+	// Messages are sent as client.show_message after authorization.
+	Messages []string
+
+	RejectAuthorize bool
+	AuthorizeDelay  time.Duration
+	// NotifyBeforeAuthorize sends the jobs before answering mining.authorize.
+	NotifyBeforeAuthorize bool
+	// SetExtranonce, when set, is sent after authorization and before jobs.
+	SetExtranonce *Extranonce
+	Jobs          []Job
+
+	// OversizedLine, when positive, sends a client.show_message padded to
+	// that many bytes after authorization.
+	OversizedLine int
+	// Flood sends this many mining.set_difficulty notifications back to back
+	// after authorization.
+	Flood int
+
+	// DisconnectAfter closes the connection once the server has written this
+	// many lines. Zero keeps the connection open.
+	DisconnectAfter int
+}
+
+// DefaultScenario returns a well-behaved pool with no jobs; callers add the
+// jobs and misbehaviour they want to exercise.
+func DefaultScenario() Scenario {
+	return Scenario{
+		ExtraNonce1:     "f000000f",
+		ExtraNonce2Size: 8,
+		Difficulty:      1024,
+	}
+}
+
+// Server is a Stratum V1 pool listening on localhost.
+type Server struct {
+	scenario Scenario
+	ln       net.Listener
+	tls      *tls.Config
+
+	mu       sync.Mutex
+	conns    []net.Conn
+	received []string
+	wg       sync.WaitGroup
+}
+
+// NewServer starts a plain TCP server running scenario.
+func NewServer(scenario Scenario) (*Server, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	return start(scenario, ln, nil), nil
+}
+
+// NewTLSServer starts a TLS server with a freshly generated self-signed
+// certificate; ClientTLSConfig returns a config that trusts it.
+func NewTLSServer(scenario Scenario) (*Server, error) {
+	cert, pool, err := generateCertificate()
+	if err != nil {
+		return nil, err
+	}
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		return nil, err
+	}
+	return start(scenario, ln, &tls.Config{RootCAs: pool}), nil
+}
+
+func start(scenario Scenario, ln net.Listener, clientTLS *tls.Config) *Server {
+	s := &Server{scenario: scenario, ln: ln, tls: clientTLS}
+	s.wg.Add(1)
+	go s.serve()
+	return s
+}
+
+func (s *Server) Host() string {
+	host, _, _ := net.SplitHostPort(s.ln.Addr().String())
+	return host
+}
+
+func (s *Server) Port() int {
+	_, port, _ := net.SplitHostPort(s.ln.Addr().String())
+	p, _ := strconv.Atoi(port)
+	return p
+}
+
+// ClientTLSConfig returns a config trusting the server certificate, or nil
+// for plain servers.
+func (s *Server) ClientTLSConfig() *tls.Config {
+	if s.tls == nil {
+		return nil
+	}
+	return s.tls.Clone()
+}
+
+// Received returns every line clients have sent so far.
+func (s *Server) Received() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.received...)
+}
+
+func (s *Server) Close() {
+	_ = s.ln.Close()
+	s.mu.Lock()
+	for _, c := range s.conns {
+		_ = c.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.conns = append(s.conns, conn)
+		s.mu.Unlock()
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer conn.Close()
+			sess := &session{server: s, conn: conn}
+			_ = sess.run()
+		}()
+	}
+}
+
+var errDisconnect = errors.New("stratumtest: scripted disconnect")
+
+type session struct {
+	server   *Server
+	conn     net.Conn
+	written  int
+	jobsSent bool
+}
+
+type request struct {
+	ID     json.RawMessage `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+}
+
+func (ss *session) run() error {
+	sc := ss.server.scenario
+	reader := bufio.NewReader(ss.conn)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		ss.server.mu.Lock()
+		ss.server.received = append(ss.server.received, line)
+		ss.server.mu.Unlock()
+
+		var req request
+		if err := json.Unmarshal([]byte(line), &req); err != nil || req.Method == "" {
+			continue
+		}
+		switch req.Method {
+		case "mining.subscribe":
+			time.Sleep(sc.SubscribeDelay)
+			result := []any{[][]string{{"mining.set_difficulty", "1"}, {"mining.notify", "1"}}, sc.ExtraNonce1, sc.ExtraNonce2Size}
+			if err := ss.respond(req.ID, result, nil); err != nil {
+				return err
+			}
+			for _, g := range sc.GarbageLines {
+				if err := ss.writeLine(g); err != nil {
+					return err
+				}
+			}
+			if sc.Difficulty > 0 {
+				if err := ss.notify("mining.set_difficulty", []any{sc.Difficulty}); err != nil {
+					return err
+				}
+			}
+		case "mining.authorize":
+			if sc.NotifyBeforeAuthorize {
+				if err := ss.sendJobs(); err != nil {
+					return err
+				}
+			}
+			time.Sleep(sc.AuthorizeDelay)
+			if sc.RejectAuthorize {
+				if err := ss.respond(req.ID, false, []any{24, "Unauthorized worker", nil}); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := ss.respond(req.ID, true, nil); err != nil {
+				return err
+			}
+			if err := ss.afterAuthorize(); err != nil {
+				return err
+			}
+		case "mining.extranonce.subscribe":
+			if err := ss.respond(req.ID, true, nil); err != nil {
+				return err
+			}
+		default:
+			if err := ss.respond(req.ID, nil, []any{20, "Unsupported method", nil}); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (ss *session) afterAuthorize() error {
+	sc := ss.server.scenario
+	if sc.SetExtranonce != nil {
+		if err := ss.notify("mining.set_extranonce", []any{sc.SetExtranonce.ExtraNonce1, sc.SetExtranonce.ExtraNonce2Size}); err != nil {
+			return err
+		}
+	}
+	if sc.OversizedLine > 0 {
+		if err := ss.notify("client.show_message", []any{strings.Repeat("A", sc.OversizedLine)}); err != nil {
+			return err
+		}
+	}
+	for i := 0; i < sc.Flood; i++ {
+		if err := ss.notify("mining.set_difficulty", []any{sc.Difficulty + float64(i)}); err != nil {
+			return err
+		}
+	}
+	for _, msg := range sc.Messages {
+		if err := ss.notify("client.show_message", []any{msg}); err != nil {
+			return err
+		}
+	}
+	return ss.sendJobs()
+}
+
+func (ss *session) sendJobs() error {
+	if ss.jobsSent {
+		return nil
+	}
+	ss.jobsSent = true
+	for i, job := range ss.server.scenario.Jobs {
+		if err := ss.notify("mining.notify", job.params(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (j Job) params(index int) []any {
+	id := j.ID
+	if id == "" {
+		id = strconv.Itoa(index + 1)
+	}
+	branch := j.MerkleBranch
+	if branch == nil {
+		branch = []string{}
+	}
+	return []any{
+		id,
+		orDefault(j.PrevHash, strings.Repeat("0", 64)),
+		j.CoinBase1,
+		j.CoinBase2,
+		branch,
+		orDefault(j.Version, "20000000"),
+		orDefault(j.NBits, "1d00ffff"),
+		orDefault(j.NTime, fmt.Sprintf("%08x", time.Now().Unix())),
+		j.Clean,
+	}
+}
+
+func orDefault(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
+
+func (ss *session) respond(id json.RawMessage, result, rpcErr any) error {
+	payload, err := json.Marshal(map[string]any{"id": id, "result": result, "error": rpcErr})
+	if err != nil {
+		return err
+	}
+	return ss.writeLine(string(payload))
+}
+
+func (ss *session) notify(method string, params []any) error {
+	payload, err := json.Marshal(map[string]any{"id": nil, "method": method, "params": params})
+	if err != nil {
+		return err
+	}
+	return ss.writeLine(string(payload))
+}
+
+func (ss *session) writeLine(line string) error {
+	if _, err := ss.conn.Write([]byte(line + "\n")); err != nil {
+		return err
+	}
+	ss.written++
+	if limit := ss.server.scenario.DisconnectAfter; limit > 0 && ss.written >= limit {
+		_ = ss.conn.Close()
+		return errDisconnect
+	}
+	return nil
+}
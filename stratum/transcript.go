@@ -0,0 +1,55 @@
+package stratum
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DirectionSent     = "send"
+	DirectionReceived = "recv"
+)
+
+// TranscriptLine is one line on the wire. Offset is measured on the monotonic
+// clock from the moment the transcript was created.
+type TranscriptLine struct {
+	Offset    time.Duration
+	Direction string
+	Line      string
+}
+
+// Transcript records every line a Client sends and receives.
+type Transcript struct {
+	mu    sync.Mutex
+	start time.Time
+	lines []TranscriptLine
+}
+
+func NewTranscript() *Transcript {
+	return &Transcript{start: time.Now()}
+}
+
+func (t *Transcript) record(direction string, line []byte) {
+	if t == nil {
+		return
+	}
+	entry := TranscriptLine{
+		Offset:    time.Since(t.start),
+		Direction: direction,
+		Line:      strings.TrimRight(string(line), "\r\n"),
+	}
+	t.mu.Lock()
+	t.lines = append(t.lines, entry)
+	t.mu.Unlock()
+}
+
+// Lines returns a copy of the recorded lines.
+func (t *Transcript) Lines() []TranscriptLine {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]TranscriptLine(nil), t.lines...)
+}
@@ -1,19 +1,67 @@
 package stratum
 
 type NotifyParams struct {
+	// PrevHash is the previous block's hash in the usual display byte order,
+	// or empty if the pool sent something that is not a 32-byte hash.
+	PrevHash  string
 	CoinBase1 string
 	CoinBase2 string
+	// MerkleBranch holds the hashes the coinbase txid is folded with, in the
+	// internal byte order the pool sent.
+	MerkleBranch []string
+	// Version, NBits and NTime are the header's version, compact target and
+	// timestamp as the big-endian hex the pool sent, or empty if they were
+	// missing or not 4-byte words.
+	Version string
+	NBits   string
+	NTime   string
 }
 
 type CoinbaseOutput struct {
-	Address    string
-	ValueBTC   float64
+	// Address is empty for outputs no address encodes: P2PK, bare multisig,
+	// OP_RETURN and non-standard scripts.
+	Address string
+	// Value is the output's amount in satoshis, as serialized.
+	Value int64
+	// ScriptType is one of the Script* constants.
 	ScriptType string
+	PkScript   []byte
+	// PubKeys are the hex keys a P2PK or bare multisig output pays, in script
+	// order; RequiredSigs is how many of them must sign.
+	PubKeys      []string
+	RequiredSigs int
+	// Asm is the disassembled script of outputs without an address.
+	Asm string
+	// Unspendable is set when no transaction can ever spend the output.
+	Unspendable bool
 }
 
 type CoinbaseInfo struct {
 	ExtraNonce2 string
 	ScriptSig   []byte
 	Outputs     []CoinbaseOutput
+	// ScriptSigLayout is nil when the extranonce cannot be located.
+	ScriptSigLayout *ScriptSigLayout
+	// Commitments lists the OP_RETURN payloads and scriptSig merged-mining
+	// roots in the coinbase.
+	Commitments []Commitment
+	// Lint lists structural problems with the coinbase transaction.
+	Lint []LintFinding
 }
 
+const (
+	DeviationInvalidJSON        = "invalid_json"
+	DeviationUnknownMethod      = "unknown_method"
+	DeviationUnexpectedResponse = "unexpected_response"
+	DeviationMalformedNotify    = "malformed_notify"
+	DeviationMalformedParams    = "malformed_params"
+	DeviationZeroExtraNonce2    = "zero_extranonce2_size"
+	DeviationBadExtraNonce2     = "invalid_extranonce2_size"
+)
+
+// Deviation records a message from the server that does not follow the
+// Stratum V1 conventions the client expects.
+type Deviation struct {
+	Kind   string
+	Detail string
+}
@@ -0,0 +1,269 @@
+package sv2
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+
+	"poolcensus/desktop/stratum"
+)
+
+const protocolVersion = 2
+
+// Client probes a Stratum V2 mining endpoint: it performs the Noise handshake,
+// sets up a mining connection, opens one channel and waits for its first job.
+type Client struct {
+	host      string
+	port      int
+	authority *btcec.PublicKey
+	limits    stratum.Limits
+
+	conn      *Conn
+	requestID uint32
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithLimits replaces stratum.DefaultLimits for this client's frames.
+func WithLimits(l stratum.Limits) Option {
+	return func(c *Client) {
+		c.limits = l
+	}
+}
+
+// Job is the first piece of work received on a channel. Extended is set for
+// extended channels and Standard for standard channels.
+type Job struct {
+	Extended *NewExtendedMiningJob
+	Standard *NewMiningJob
+	PrevHash *SetNewPrevHash
+}
+
+// Channel describes an opened mining channel.
+type Channel struct {
+	ID               uint32
+	Extended         bool
+	Target           [32]byte
+	ExtranoncePrefix []byte
+	ExtranonceSize   int
+}
+
+// NewClient creates a client for host:port. authority may be nil, in which
+// case the server certificate is not verified.
+func NewClient(host string, port int, authority *btcec.PublicKey, opts ...Option) *Client {
+	c := &Client{host: host, port: port, authority: authority, limits: stratum.DefaultLimits()}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+func (c *Client) Connect() error {
+	if c.conn != nil {
+		return nil
+	}
+	addr := net.JoinHostPort(c.host, strconv.Itoa(c.port))
+	dialer := &net.Dialer{Timeout: 12 * time.Second, KeepAlive: 30 * time.Second}
+	raw, err := dialer.Dial("tcp", addr)
+	if err != nil {
+		return err
+	}
+	_ = raw.SetDeadline(time.Now().Add(20 * time.Second))
+	conn, err := ClientHandshake(raw, c.authority)
+	if err != nil {
+		_ = raw.Close()
+		return err
+	}
+	_ = raw.SetDeadline(time.Time{})
+	conn.SetLimits(c.limits)
+	c.conn = conn
+	return nil
+}
+
+func (c *Client) Close() {
+	if c.conn != nil {
+		_ = c.conn.Close()
+		c.conn = nil
+	}
+}
+
+// Certificate returns the certificate presented during the handshake.
+func (c *Client) Certificate() *Certificate {
+	if c.conn == nil {
+		return nil
+	}
+	return c.conn.Certificate()
+}
+
+func (c *Client) SetupConnection(vendor, hardware, firmware string, flags uint32) (*SetupConnectionSuccess, error) {
+	if c.conn == nil {
+		return nil, errors.New("not connected")
+	}
+	req := &SetupConnection{
+		MinVersion:      protocolVersion,
+		MaxVersion:      protocolVersion,
+		Flags:           flags,
+		EndpointHost:    c.host,
+		EndpointPort:    uint16(c.port),
+		Vendor:          vendor,
+		HardwareVersion: hardware,
+		Firmware:        firmware,
+	}
+	if err := c.conn.WriteMessage(req); err != nil {
+		return nil, err
+	}
+	msg, err := c.readUntil(20*time.Second, func(msg any) bool {
+		switch msg.(type) {
+		case *SetupConnectionSuccess, *SetupConnectionError:
+			return true
+		}
+		return false
+	})
+	if err != nil {
+		return nil, fmt.Errorf("SetupConnection: %w", err)
+	}
+	if e, ok := msg.(*SetupConnectionError); ok {
+		return nil, fmt.Errorf("SetupConnection: %s", e.ErrorCode)
+	}
+	return msg.(*SetupConnectionSuccess), nil
+}
+
+// OpenExtendedChannel opens an extended channel, which exposes the coinbase.
+func (c *Client) OpenExtendedChannel(user string, minExtranonceSize uint16) (*Channel, error) {
+	c.requestID++
+	req := &OpenExtendedMiningChannel{
+		RequestID:        c.requestID,
+		UserIdentity:     user,
+		NominalHashRate:  1e12,
+		MaxTarget:        maxTarget(),
+		MinExtranonceLen: minExtranonceSize,
+	}
+	msg, err := c.openChannel(req, req.RequestID)
+	if err != nil {
+		return nil, fmt.Errorf("OpenExtendedMiningChannel: %w", err)
+	}
+	ok, isExtended := msg.(*OpenExtendedMiningChannelSuccess)
+	if !isExtended {
+		return nil, fmt.Errorf("OpenExtendedMiningChannel: unexpected %T", msg)
+	}
+	return &Channel{
+		ID:               ok.ChannelID,
+		Extended:         true,
+		Target:           ok.Target,
+		ExtranoncePrefix: ok.ExtranoncePrefix,
+		ExtranonceSize:   int(ok.ExtranonceSize),
+	}, nil
+}
+
+// OpenStandardChannel opens a standard channel. Jobs on it only carry a merkle
+// root, so the coinbase cannot be inspected.
+func (c *Client) OpenStandardChannel(user string) (*Channel, error) {
+	c.requestID++
+	req := &OpenStandardMiningChannel{
+		RequestID:       c.requestID,
+		UserIdentity:    user,
+		NominalHashRate: 1e12,
+		MaxTarget:       maxTarget(),
+	}
+	msg, err := c.openChannel(req, req.RequestID)
+	if err != nil {
+		return nil, fmt.Errorf("OpenStandardMiningChannel: %w", err)
+	}
+	ok, isStandard := msg.(*OpenStandardMiningChannelSuccess)
+	if !isStandard {
+		return nil, fmt.Errorf("OpenStandardMiningChannel: unexpected %T", msg)
+	}
+	return &Channel{
+		ID:               ok.ChannelID,
+		Target:           ok.Target,
+		ExtranoncePrefix: ok.ExtranoncePrefix,
+	}, nil
+}
+
+func (c *Client) openChannel(req encodable, requestID uint32) (any, error) {
+	if c.conn == nil {
+		return nil, errors.New("not connected")
+	}
+	if err := c.conn.WriteMessage(req); err != nil {
+		return nil, err
+	}
+	msg, err := c.readUntil(20*time.Second, func(msg any) bool {
+		switch m := msg.(type) {
+		case *OpenExtendedMiningChannelSuccess:
+			return m.RequestID == requestID
+		case *OpenStandardMiningChannelSuccess:
+			return m.RequestID == requestID
+		case *OpenMiningChannelError:
+			return m.RequestID == requestID
+		}
+		return false
+	})
+	if err != nil {
+		return nil, err
+	}
+	if e, ok := msg.(*OpenMiningChannelError); ok {
+		return nil, errors.New(e.ErrorCode)
+	}
+	return msg, nil
+}
+
+// WaitJob waits for the first job on channel and the SetNewPrevHash that
+// activates it. If the prev hash does not arrive in time the job is returned
+// without it.
+func (c *Client) WaitJob(channel *Channel, timeout time.Duration) (*Job, error) {
+	if c.conn == nil {
+		return nil, errors.New("not connected")
+	}
+	job := &Job{}
+	_, err := c.readUntil(timeout, func(msg any) bool {
+		switch m := msg.(type) {
+		case *NewExtendedMiningJob:
+			if m.ChannelID == channel.ID && job.Extended == nil {
+				job.Extended = m
+			}
+		case *NewMiningJob:
+			if m.ChannelID == channel.ID && job.Standard == nil {
+				job.Standard = m
+			}
+		case *SetNewPrevHash:
+			if m.ChannelID == channel.ID {
+				job.PrevHash = m
+			}
+		}
+		return (job.Extended != nil || job.Standard != nil) && job.PrevHash != nil
+	})
+	if err != nil {
+		if job.Extended != nil || job.Standard != nil {
+			return job, nil
+		}
+		return nil, fmt.Errorf("waiting for job: %w", err)
+	}
+	return job, nil
+}
+
+func (c *Client) readUntil(timeout time.Duration, match func(msg any) bool) (any, error) {
+	_ = c.conn.SetReadDeadline(time.Now().Add(timeout))
+	defer c.conn.SetReadDeadline(time.Time{})
+	for {
+		msg, err := c.conn.ReadMessage()
+		if err != nil {
+			return nil, err
+		}
+		if match(msg) {
+			return msg, nil
+		}
+	}
+}
+
+func maxTarget() [32]byte {
+	var t [32]byte
+	for i := range t {
+		t[i] = 0xff
+	}
+	return t
+}
@@ -0,0 +1,171 @@
+package sv2_test
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+
+	"poolcensus/desktop/stratum"
+	sv2 "poolcensus/desktop/stratum/v2"
+	"poolcensus/desktop/stratum/v2/sv2test"
+)
+
+func startServer(t *testing.T, cfg sv2test.Config) *sv2test.Server {
+	t.Helper()
+	srv, err := sv2test.NewServer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func connect(t *testing.T, srv *sv2test.Server, opts ...sv2.Option) *sv2.Client {
+	t.Helper()
+	authority, err := sv2.ParseAuthorityKey(srv.AuthorityKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := sv2.NewClient(srv.Host(), srv.Port(), authority, opts...)
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(c.Close)
+	return c
+}
+
+func TestClientExtendedChannel(t *testing.T) {
+	cfg := sv2test.Config{
+		CoinbasePrefix:   []byte{0x02, 0x00, 0x00, 0x00},
+		CoinbaseSuffix:   []byte{0xff, 0xff, 0xff, 0xff},
+		ExtranoncePrefix: []byte{0xaa, 0xbb},
+		ExtranonceSize:   8,
+		MerklePath:       [][32]byte{{1}, {2}},
+		Version:          0x20000000,
+		PrevHash:         [32]byte{3},
+		NBits:            0x17034219,
+	}
+	srv := startServer(t, cfg)
+	c := connect(t, srv)
+
+	if cert := c.Certificate(); cert == nil || !cert.Verified {
+		t.Fatalf("certificate %+v, want verified", cert)
+	}
+	if _, err := c.SetupConnection("bitaxe", "BM1370", "v2.6.1", 0); err != nil {
+		t.Fatal(err)
+	}
+	ch, err := c.OpenExtendedChannel("bc1qworker.rig", 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ch.Extended || ch.ExtranonceSize != 8 || !bytes.Equal(ch.ExtranoncePrefix, cfg.ExtranoncePrefix) {
+		t.Errorf("channel %+v", ch)
+	}
+	job, err := c.WaitJob(ch, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Extended == nil || job.PrevHash == nil {
+		t.Fatalf("job %+v, want an extended job and its prev hash", job)
+	}
+	if !bytes.Equal(job.Extended.CoinbaseTxPrefix, cfg.CoinbasePrefix) || !bytes.Equal(job.Extended.CoinbaseTxSuffix, cfg.CoinbaseSuffix) {
+		t.Errorf("coinbase %x / %x", job.Extended.CoinbaseTxPrefix, job.Extended.CoinbaseTxSuffix)
+	}
+	if len(job.Extended.MerklePath) != 2 || job.PrevHash.PrevHash != cfg.PrevHash || job.PrevHash.NBits != cfg.NBits {
+		t.Errorf("job %+v, prev hash %+v", job.Extended, job.PrevHash)
+	}
+
+	setups := srv.Setups()
+	if len(setups) != 1 || setups[0].Vendor != "bitaxe" || setups[0].EndpointPort != uint16(srv.Port()) {
+		t.Errorf("setups %+v", setups)
+	}
+	if users := srv.Users(); len(users) != 1 || users[0] != "bc1qworker.rig" {
+		t.Errorf("users %v", users)
+	}
+}
+
+func TestClientStandardFallback(t *testing.T) {
+	srv := startServer(t, sv2test.Config{RejectExtended: true, MerkleRoot: [32]byte{9}, NBits: 0x1d00ffff})
+	c := connect(t, srv)
+	if _, err := c.SetupConnection("bitaxe", "BM1370", "v2.6.1", 0); err != nil {
+		t.Fatal(err)
+	}
+	_, err := c.OpenExtendedChannel("worker", 4)
+	if err == nil || !strings.Contains(err.Error(), "unsupported-extended-channel") {
+		t.Fatalf("got %v, want the pool's rejection", err)
+	}
+	ch, err := c.OpenStandardChannel("worker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ch.Extended {
+		t.Error("standard channel reported as extended")
+	}
+	job, err := c.WaitJob(ch, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Standard == nil || !bytes.Equal(job.Standard.MerkleRoot, (&[32]byte{9})[:]) || job.Extended != nil {
+		t.Fatalf("job %+v, want a standard job", job)
+	}
+}
+
+func TestClientSetupError(t *testing.T) {
+	srv := startServer(t, sv2test.Config{SetupError: "unsupported-feature-flags"})
+	c := connect(t, srv)
+	_, err := c.SetupConnection("bitaxe", "BM1370", "v2.6.1", sv2.FlagRequiresVersionRolling)
+	if err == nil || !strings.Contains(err.Error(), "unsupported-feature-flags") {
+		t.Fatalf("got %v, want the setup error code", err)
+	}
+}
+
+func TestClientBadCertificate(t *testing.T) {
+	srv := startServer(t, sv2test.Config{})
+	other, err := btcec.NewPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := sv2.NewClient(srv.Host(), srv.Port(), other.PubKey())
+	defer c.Close()
+	err = c.Connect()
+	if err == nil || !strings.Contains(err.Error(), "not signed by authority") {
+		t.Fatalf("got %v, want a certificate error", err)
+	}
+	if c.Certificate() != nil {
+		t.Error("failed connection kept a certificate")
+	}
+}
+
+func TestClientUnverifiedWithoutAuthority(t *testing.T) {
+	srv := startServer(t, sv2test.Config{})
+	c := sv2.NewClient(srv.Host(), srv.Port(), nil)
+	defer c.Close()
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	if cert := c.Certificate(); cert == nil || cert.Verified {
+		t.Fatalf("certificate %+v, want recorded but unverified", cert)
+	}
+}
+
+func TestClientFrameLimit(t *testing.T) {
+	// The extended job carries the whole coinbase, so it trips a small cap.
+	srv := startServer(t, sv2test.Config{CoinbasePrefix: make([]byte, 4096), ExtranonceSize: 8})
+	c := connect(t, srv, sv2.WithLimits(stratum.Limits{MaxLineBytes: 1024}))
+	if _, err := c.SetupConnection("bitaxe", "BM1370", "v2.6.1", 0); err != nil {
+		t.Fatal(err)
+	}
+	ch, err := c.OpenExtendedChannel("worker", 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.WaitJob(ch, 5*time.Second)
+	var limitErr *stratum.LimitError
+	if !errors.As(err, &limitErr) || limitErr.Limit != stratum.LimitLineBytes {
+		t.Fatalf("got %v, want a line_bytes limit error", err)
+	}
+}
@@ -0,0 +1,196 @@
+package sv2
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+var errShortMessage = errors.New("sv2: message too short")
+
+// encoder appends Stratum V2 binary data types (all little-endian) to buf.
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) u8(v uint8) {
+	e.buf = append(e.buf, v)
+}
+
+func (e *encoder) bool(v bool) {
+	if v {
+		e.u8(1)
+	} else {
+		e.u8(0)
+	}
+}
+
+func (e *encoder) u16(v uint16) {
+	e.buf = binary.LittleEndian.AppendUint16(e.buf, v)
+}
+
+func (e *encoder) u32(v uint32) {
+	e.buf = binary.LittleEndian.AppendUint32(e.buf, v)
+}
+
+func (e *encoder) f32(v float32) {
+	e.u32(math.Float32bits(v))
+}
+
+func (e *encoder) u256(v [32]byte) {
+	e.buf = append(e.buf, v[:]...)
+}
+
+func (e *encoder) str0255(s string) error {
+	return e.b0255([]byte(s))
+}
+
+func (e *encoder) b0255(b []byte) error {
+	if len(b) > 255 {
+		return fmt.Errorf("sv2: field too long (%d > 255)", len(b))
+	}
+	e.u8(uint8(len(b)))
+	e.buf = append(e.buf, b...)
+	return nil
+}
+
+func (e *encoder) b032(b []byte) error {
+	if len(b) > 32 {
+		return fmt.Errorf("sv2: field too long (%d > 32)", len(b))
+	}
+	return e.b0255(b)
+}
+
+func (e *encoder) b064k(b []byte) error {
+	if len(b) > math.MaxUint16 {
+		return fmt.Errorf("sv2: field too long (%d > 65535)", len(b))
+	}
+	e.u16(uint16(len(b)))
+	e.buf = append(e.buf, b...)
+	return nil
+}
+
+func (e *encoder) seq0255u256(items [][32]byte) error {
+	if len(items) > 255 {
+		return fmt.Errorf("sv2: sequence too long (%d > 255)", len(items))
+	}
+	e.u8(uint8(len(items)))
+	for _, item := range items {
+		e.u256(item)
+	}
+	return nil
+}
+
+func (e *encoder) optionU32(v *uint32) {
+	if v == nil {
+		e.u8(0)
+		return
+	}
+	e.u8(1)
+	e.u32(*v)
+}
+
+// decoder reads Stratum V2 binary data types from buf. The first error
+// sticks, so callers can decode a whole message and check err once.
+type decoder struct {
+	buf []byte
+	err error
+}
+
+func (d *decoder) take(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if len(d.buf) < n {
+		d.err = errShortMessage
+		return nil
+	}
+	out := d.buf[:n]
+	d.buf = d.buf[n:]
+	return out
+}
+
+func (d *decoder) u8() uint8 {
+	b := d.take(1)
+	if b == nil {
+		return 0
+	}
+	return b[0]
+}
+
+func (d *decoder) bool() bool {
+	return d.u8() != 0
+}
+
+func (d *decoder) u16() uint16 {
+	b := d.take(2)
+	if b == nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint16(b)
+}
+
+func (d *decoder) u32() uint32 {
+	b := d.take(4)
+	if b == nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint32(b)
+}
+
+func (d *decoder) f32() float32 {
+	return math.Float32frombits(d.u32())
+}
+
+func (d *decoder) u256() [32]byte {
+	var out [32]byte
+	copy(out[:], d.take(32))
+	return out
+}
+
+func (d *decoder) str0255() string {
+	return string(d.b0255())
+}
+
+func (d *decoder) b0255() []byte {
+	n := int(d.u8())
+	return append([]byte(nil), d.take(n)...)
+}
+
+func (d *decoder) b032() []byte {
+	b := d.b0255()
+	if d.err == nil && len(b) > 32 {
+		d.err = fmt.Errorf("sv2: field too long (%d > 32)", len(b))
+	}
+	return b
+}
+
+func (d *decoder) b064k() []byte {
+	n := int(d.u16())
+	return append([]byte(nil), d.take(n)...)
+}
+
+func (d *decoder) seq0255u256() [][32]byte {
+	n := int(d.u8())
+	out := make([][32]byte, 0, n)
+	for i := 0; i < n && d.err == nil; i++ {
+		out = append(out, d.u256())
+	}
+	return out
+}
+
+func (d *decoder) optionU32() *uint32 {
+	switch d.u8() {
+	case 0:
+		return nil
+	case 1:
+		v := d.u32()
+		return &v
+	default:
+		if d.err == nil {
+			d.err = errors.New("sv2: invalid option tag")
+		}
+		return nil
+	}
+}
@@ -0,0 +1,192 @@
+package sv2
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+
+	"poolcensus/desktop/stratum"
+)
+
+const (
+	headerLen = 6
+	// maxChunk is the largest plaintext encrypted as one Noise message.
+	maxChunk = 65535 - macLen
+	// maxPayload is the largest payload a u24 length can describe.
+	maxPayload = 1<<24 - 1
+)
+
+// Conn is an encrypted, framed Stratum V2 connection.
+type Conn struct {
+	net.Conn
+	cert *Certificate
+
+	readMu  sync.Mutex
+	writeMu sync.Mutex
+	send    *cipherState
+	recv    *cipherState
+
+	// limits caps what the peer may send; MaxLineBytes bounds one frame's
+	// payload. received counts ciphertext read after the handshake.
+	limits   stratum.Limits
+	received int64
+}
+
+// SetLimits applies l to every frame read from now on. Only MaxLineBytes and
+// MaxSessionBytes apply to frames.
+func (c *Conn) SetLimits(l stratum.Limits) {
+	c.readMu.Lock()
+	c.limits = l
+	c.readMu.Unlock()
+}
+
+// readFull reads len(buf) bytes, counting them against MaxSessionBytes before
+// they are read.
+func (c *Conn) readFull(buf []byte) error {
+	c.received += int64(len(buf))
+	if c.limits.MaxSessionBytes > 0 && c.received > c.limits.MaxSessionBytes {
+		return &stratum.LimitError{Limit: stratum.LimitSessionBytes, Max: c.limits.MaxSessionBytes}
+	}
+	_, err := io.ReadFull(c.Conn, buf)
+	return err
+}
+
+// Certificate returns the certificate presented by the server, or nil on the
+// server side of a connection.
+func (c *Conn) Certificate() *Certificate {
+	return c.cert
+}
+
+// WriteMessage encodes and sends msg.
+func (c *Conn) WriteMessage(msg encodable) error {
+	msgType, err := messageType(msg)
+	if err != nil {
+		return err
+	}
+	payload, err := msg.encode()
+	if err != nil {
+		return err
+	}
+	var ext uint16
+	if isChannelMessage(msgType) {
+		ext |= channelMsgBit
+	}
+	return c.WriteFrame(&Frame{ExtensionType: ext, MsgType: msgType, Payload: payload})
+}
+
+// WriteFrame encrypts and sends a raw frame.
+func (c *Conn) WriteFrame(f *Frame) error {
+	if len(f.Payload) > maxPayload {
+		return fmt.Errorf("sv2: payload too large (%d)", len(f.Payload))
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	header := make([]byte, headerLen)
+	binary.LittleEndian.PutUint16(header[0:2], f.ExtensionType)
+	header[2] = f.MsgType
+	header[3] = byte(len(f.Payload))
+	header[4] = byte(len(f.Payload) >> 8)
+	header[5] = byte(len(f.Payload) >> 16)
+
+	out, err := c.send.encrypt(nil, header)
+	if err != nil {
+		return err
+	}
+	for rest := f.Payload; len(rest) > 0; {
+		n := len(rest)
+		if n > maxChunk {
+			n = maxChunk
+		}
+		chunk, err := c.send.encrypt(nil, rest[:n])
+		if err != nil {
+			return err
+		}
+		out = append(out, chunk...)
+		rest = rest[n:]
+	}
+	_, err = c.Conn.Write(out)
+	return err
+}
+
+// ReadFrame reads and decrypts the next frame.
+func (c *Conn) ReadFrame() (*Frame, error) {
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
+
+	encHeader := make([]byte, headerLen+macLen)
+	if err := c.readFull(encHeader); err != nil {
+		return nil, err
+	}
+	header, err := c.recv.decrypt(nil, encHeader)
+	if err != nil {
+		return nil, err
+	}
+	f := &Frame{
+		ExtensionType: binary.LittleEndian.Uint16(header[0:2]),
+		MsgType:       header[2],
+	}
+	length := int(header[3]) | int(header[4])<<8 | int(header[5])<<16
+	// The length is the peer's claim; refuse it before buffering anything.
+	if c.limits.MaxLineBytes > 0 && length > c.limits.MaxLineBytes {
+		return nil, &stratum.LimitError{Limit: stratum.LimitLineBytes, Max: int64(c.limits.MaxLineBytes)}
+	}
+	for length > 0 {
+		n := length
+		if n > maxChunk {
+			n = maxChunk
+		}
+		chunk := make([]byte, n+macLen)
+		if err := c.readFull(chunk); err != nil {
+			return nil, err
+		}
+		plain, err := c.recv.decrypt(nil, chunk)
+		if err != nil {
+			return nil, err
+		}
+		f.Payload = append(f.Payload, plain...)
+		length -= n
+	}
+	return f, nil
+}
+
+// ReadMessage reads the next frame and decodes it. Unknown message types are
+// returned as the raw *Frame.
+func (c *Conn) ReadMessage() (any, error) {
+	f, err := c.ReadFrame()
+	if err != nil {
+		return nil, err
+	}
+	msg, err := decodeMessage(f)
+	if err != nil {
+		return nil, err
+	}
+	if msg == nil {
+		return f, nil
+	}
+	return msg, nil
+}
+
+// ClientHandshake performs the initiator side of the Noise handshake on conn.
+// When authority is nil the server certificate is recorded but not verified.
+func ClientHandshake(conn net.Conn, authority *btcec.PublicKey) (*Conn, error) {
+	send, recv, cert, err := initiatorHandshake(conn, authority, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return &Conn{Conn: conn, cert: cert, send: send, recv: recv}, nil
+}
+
+// ServerHandshake performs the responder side of the Noise handshake on conn.
+func ServerHandshake(conn net.Conn, keys *ResponderKeys) (*Conn, error) {
+	send, recv, err := responderHandshake(conn, keys)
+	if err != nil {
+		return nil, err
+	}
+	return &Conn{Conn: conn, send: send, recv: recv}, nil
+}
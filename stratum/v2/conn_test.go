@@ -0,0 +1,210 @@
+package sv2
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+
+	"poolcensus/desktop/stratum"
+)
+
+// newKeys returns responder keys signed by a fresh authority and valid for
+// the given window around now.
+func newKeys(t *testing.T, from, until time.Duration) (*btcec.PrivateKey, *ResponderKeys) {
+	t.Helper()
+	authority, err := btcec.NewPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	keys, err := NewResponderKeys(authority, now.Add(from), now.Add(until))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return authority, keys
+}
+
+// handshake runs both sides of the Noise handshake over an in-memory pipe.
+func handshake(t *testing.T, authority *btcec.PublicKey, keys *ResponderKeys) (client, server *Conn, err error) {
+	t.Helper()
+	a, b := net.Pipe()
+	t.Cleanup(func() {
+		a.Close()
+		b.Close()
+	})
+	type result struct {
+		conn *Conn
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		conn, err := ServerHandshake(b, keys)
+		done <- result{conn, err}
+	}()
+	client, err = ClientHandshake(a, authority)
+	if err != nil {
+		// The responder has already written act two and is done.
+		<-done
+		return nil, nil, err
+	}
+	r := <-done
+	if r.err != nil {
+		t.Fatalf("server handshake: %v", r.err)
+	}
+	return client, r.conn, nil
+}
+
+func TestHandshakeVerifiesCertificate(t *testing.T) {
+	authority, keys := newKeys(t, -time.Hour, time.Hour)
+	client, server, err := handshake(t, authority.PubKey(), keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := client.Certificate()
+	if cert == nil || !cert.Verified {
+		t.Fatalf("certificate not verified: %+v", cert)
+	}
+	if cert.ServerKey != keys.Certificate.ServerKey {
+		t.Errorf("server key %x, want %x", cert.ServerKey, keys.Certificate.ServerKey)
+	}
+	if server.Certificate() != nil {
+		t.Error("server side has a certificate")
+	}
+
+	go server.WriteMessage(&SetupConnectionSuccess{UsedVersion: 2, Flags: 1})
+	msg, err := client.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, isSuccess := msg.(*SetupConnectionSuccess); !isSuccess || ok.UsedVersion != 2 || ok.Flags != 1 {
+		t.Fatalf("got %#v", msg)
+	}
+}
+
+func TestHandshakeWithoutAuthority(t *testing.T) {
+	_, keys := newKeys(t, -time.Hour, time.Hour)
+	client, _, err := handshake(t, nil, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert := client.Certificate(); cert == nil || cert.Verified {
+		t.Fatalf("certificate %+v, want recorded but unverified", cert)
+	}
+}
+
+func TestHandshakeRejectsCertificate(t *testing.T) {
+	other, err := btcec.NewPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, current := newKeys(t, -time.Hour, time.Hour)
+	expiredAuthority, expired := newKeys(t, -2*time.Hour, -time.Hour)
+	futureAuthority, future := newKeys(t, time.Hour, 2*time.Hour)
+
+	tests := []struct {
+		name      string
+		authority *btcec.PublicKey
+		keys      *ResponderKeys
+		want      string
+	}{
+		{"wrong authority", other.PubKey(), current, "not signed by authority"},
+		{"expired", expiredAuthority.PubKey(), expired, "certificate valid"},
+		{"not yet valid", futureAuthority.PubKey(), future, "certificate valid"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := handshake(t, tt.authority, tt.keys)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("got %v, want error containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestFrameChunking(t *testing.T) {
+	authority, keys := newKeys(t, -time.Hour, time.Hour)
+	client, server, err := handshake(t, authority.PubKey(), keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sizes := []int{0, 1, maxChunk - 1, maxChunk, maxChunk + 1, 3*maxChunk + 17}
+	for _, size := range sizes {
+		payload := bytes.Repeat([]byte{byte(size)}, size)
+		errc := make(chan error, 1)
+		go func() {
+			errc <- server.WriteFrame(&Frame{ExtensionType: 0x8000, MsgType: 0x42, Payload: payload})
+		}()
+		f, err := client.ReadFrame()
+		if err != nil {
+			t.Fatalf("%d bytes: %v", size, err)
+		}
+		if err := <-errc; err != nil {
+			t.Fatalf("%d bytes: write: %v", size, err)
+		}
+		if f.ExtensionType != 0x8000 || f.MsgType != 0x42 || !bytes.Equal(f.Payload, payload) {
+			t.Fatalf("%d bytes: got extension %#x type %#x and %d bytes", size, f.ExtensionType, f.MsgType, len(f.Payload))
+		}
+	}
+}
+
+func TestWriteFrameRejectsOversizedPayload(t *testing.T) {
+	authority, keys := newKeys(t, -time.Hour, time.Hour)
+	_, server, err := handshake(t, authority.PubKey(), keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := server.WriteFrame(&Frame{Payload: make([]byte, maxPayload+1)}); err == nil {
+		t.Fatal("payload over 2^24-1 bytes written without error")
+	}
+}
+
+func TestReadFrameLimits(t *testing.T) {
+	tests := []struct {
+		name   string
+		limits stratum.Limits
+		frames []int
+		want   string
+	}{
+		{"frame length", stratum.Limits{MaxLineBytes: 1024}, []int{1025}, stratum.LimitLineBytes},
+		// Each 40 byte frame costs 22 header and 56 payload bytes on the wire.
+		{"session bytes", stratum.Limits{MaxSessionBytes: 100}, []int{40, 40}, stratum.LimitSessionBytes},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authority, keys := newKeys(t, -time.Hour, time.Hour)
+			client, server, err := handshake(t, authority.PubKey(), keys)
+			if err != nil {
+				t.Fatal(err)
+			}
+			client.SetLimits(tt.limits)
+			go func() {
+				for _, size := range tt.frames {
+					if server.WriteFrame(&Frame{MsgType: 0x42, Payload: make([]byte, size)}) != nil {
+						return
+					}
+				}
+			}()
+			for i := range tt.frames {
+				_, err = client.ReadFrame()
+				if err != nil {
+					if i != len(tt.frames)-1 {
+						t.Fatalf("frame %d: %v", i, err)
+					}
+					break
+				}
+			}
+			var limitErr *stratum.LimitError
+			if !errors.As(err, &limitErr) || limitErr.Limit != tt.want {
+				t.Fatalf("got %v, want %s limit", err, tt.want)
+			}
+			if !errors.Is(err, stratum.ErrLimitExceeded) {
+				t.Error("limit error does not match ErrLimitExceeded")
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package sv2
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/btcutil/base58"
+)
+
+// authorityKeyVersion is the two-byte prefix of base58check authority keys.
+const authorityKeyVersion = 1
+
+// ParseAuthorityKey decodes a pool's authority public key as published for
+// Stratum V2 endpoints: base58check over a little-endian u16 version and the
+// 32-byte x-only key.
+func ParseAuthorityKey(s string) (*btcec.PublicKey, error) {
+	raw := base58.Decode(s)
+	if len(raw) != 2+32+4 {
+		return nil, fmt.Errorf("sv2: authority key: unexpected length %d", len(raw))
+	}
+	body, checksum := raw[:34], raw[34:]
+	if !bytes.Equal(doubleSHA256(body)[:4], checksum) {
+		return nil, errors.New("sv2: authority key: bad checksum")
+	}
+	if v := binary.LittleEndian.Uint16(body[:2]); v != authorityKeyVersion {
+		return nil, fmt.Errorf("sv2: authority key: unsupported version %d", v)
+	}
+	return schnorr.ParsePubKey(body[2:])
+}
+
+// EncodeAuthorityKey is the inverse of ParseAuthorityKey.
+func EncodeAuthorityKey(pub *btcec.PublicKey) string {
+	body := binary.LittleEndian.AppendUint16(nil, authorityKeyVersion)
+	body = append(body, schnorr.SerializePubKey(pub)...)
+	return base58.Encode(append(body, doubleSHA256(body)[:4]...))
+}
+
+func doubleSHA256(b []byte) []byte {
+	first := sha256.Sum256(b)
+	second := sha256.Sum256(first[:])
+	return second[:]
+}
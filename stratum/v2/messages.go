@@ -0,0 +1,369 @@
+package sv2
+
+import "fmt"
+
+// Message types from the Stratum V2 common and mining subprotocols.
+const (
+	MsgSetupConnection                  = 0x00
+	MsgSetupConnectionSuccess           = 0x01
+	MsgSetupConnectionError             = 0x02
+	MsgOpenStandardMiningChannel        = 0x10
+	MsgOpenStandardMiningChannelSuccess = 0x11
+	MsgOpenMiningChannelError           = 0x12
+	MsgOpenExtendedMiningChannel        = 0x13
+	MsgOpenExtendedMiningChannelSuccess = 0x14
+	MsgNewMiningJob                     = 0x15
+	MsgNewExtendedMiningJob             = 0x1f
+	MsgSetNewPrevHash                   = 0x20
+	MsgSetTarget                        = 0x21
+)
+
+const (
+	protocolMining = 0
+
+	// channelMsgBit marks frames whose payload starts with a channel_id.
+	channelMsgBit = 0x8000
+)
+
+// SetupConnection flags for the mining subprotocol.
+const (
+	FlagRequiresStandardJobs   = 1 << 0
+	FlagRequiresWorkSelection  = 1 << 1
+	FlagRequiresVersionRolling = 1 << 2
+)
+
+// Frame is a decrypted Stratum V2 message.
+type Frame struct {
+	ExtensionType uint16
+	MsgType       uint8
+	Payload       []byte
+}
+
+func isChannelMessage(msgType uint8) bool {
+	switch msgType {
+	case MsgNewMiningJob, MsgNewExtendedMiningJob, MsgSetNewPrevHash, MsgSetTarget:
+		return true
+	default:
+		return false
+	}
+}
+
+type SetupConnection struct {
+	MinVersion      uint16
+	MaxVersion      uint16
+	Flags           uint32
+	EndpointHost    string
+	EndpointPort    uint16
+	Vendor          string
+	HardwareVersion string
+	Firmware        string
+	DeviceID        string
+}
+
+func (m *SetupConnection) encode() ([]byte, error) {
+	e := &encoder{}
+	e.u8(protocolMining)
+	e.u16(m.MinVersion)
+	e.u16(m.MaxVersion)
+	e.u32(m.Flags)
+	if err := e.str0255(m.EndpointHost); err != nil {
+		return nil, err
+	}
+	e.u16(m.EndpointPort)
+	for _, s := range []string{m.Vendor, m.HardwareVersion, m.Firmware, m.DeviceID} {
+		if err := e.str0255(s); err != nil {
+			return nil, err
+		}
+	}
+	return e.buf, nil
+}
+
+func decodeSetupConnection(payload []byte) (*SetupConnection, error) {
+	d := &decoder{buf: payload}
+	if proto := d.u8(); d.err == nil && proto != protocolMining {
+		return nil, fmt.Errorf("sv2: unsupported subprotocol %d", proto)
+	}
+	m := &SetupConnection{
+		MinVersion:   d.u16(),
+		MaxVersion:   d.u16(),
+		Flags:        d.u32(),
+		EndpointHost: d.str0255(),
+		EndpointPort: d.u16(),
+	}
+	m.Vendor = d.str0255()
+	m.HardwareVersion = d.str0255()
+	m.Firmware = d.str0255()
+	m.DeviceID = d.str0255()
+	return m, d.err
+}
+
+type SetupConnectionSuccess struct {
+	UsedVersion uint16
+	Flags       uint32
+}
+
+func (m *SetupConnectionSuccess) encode() ([]byte, error) {
+	e := &encoder{}
+	e.u16(m.UsedVersion)
+	e.u32(m.Flags)
+	return e.buf, nil
+}
+
+type SetupConnectionError struct {
+	Flags     uint32
+	ErrorCode string
+}
+
+func (m *SetupConnectionError) encode() ([]byte, error) {
+	e := &encoder{}
+	e.u32(m.Flags)
+	if err := e.str0255(m.ErrorCode); err != nil {
+		return nil, err
+	}
+	return e.buf, nil
+}
+
+type OpenStandardMiningChannel struct {
+	RequestID       uint32
+	UserIdentity    string
+	NominalHashRate float32
+	MaxTarget       [32]byte
+}
+
+func (m *OpenStandardMiningChannel) encode() ([]byte, error) {
+	e := &encoder{}
+	e.u32(m.RequestID)
+	if err := e.str0255(m.UserIdentity); err != nil {
+		return nil, err
+	}
+	e.f32(m.NominalHashRate)
+	e.u256(m.MaxTarget)
+	return e.buf, nil
+}
+
+type OpenStandardMiningChannelSuccess struct {
+	RequestID        uint32
+	ChannelID        uint32
+	Target           [32]byte
+	ExtranoncePrefix []byte
+	GroupChannelID   uint32
+}
+
+func (m *OpenStandardMiningChannelSuccess) encode() ([]byte, error) {
+	e := &encoder{}
+	e.u32(m.RequestID)
+	e.u32(m.ChannelID)
+	e.u256(m.Target)
+	if err := e.b032(m.ExtranoncePrefix); err != nil {
+		return nil, err
+	}
+	e.u32(m.GroupChannelID)
+	return e.buf, nil
+}
+
+type OpenExtendedMiningChannel struct {
+	RequestID        uint32
+	UserIdentity     string
+	NominalHashRate  float32
+	MaxTarget        [32]byte
+	MinExtranonceLen uint16
+}
+
+func (m *OpenExtendedMiningChannel) encode() ([]byte, error) {
+	e := &encoder{}
+	e.u32(m.RequestID)
+	if err := e.str0255(m.UserIdentity); err != nil {
+		return nil, err
+	}
+	e.f32(m.NominalHashRate)
+	e.u256(m.MaxTarget)
+	e.u16(m.MinExtranonceLen)
+	return e.buf, nil
+}
+
+type OpenExtendedMiningChannelSuccess struct {
+	RequestID        uint32
+	ChannelID        uint32
+	Target           [32]byte
+	ExtranonceSize   uint16
+	ExtranoncePrefix []byte
+}
+
+func (m *OpenExtendedMiningChannelSuccess) encode() ([]byte, error) {
+	e := &encoder{}
+	e.u32(m.RequestID)
+	e.u32(m.ChannelID)
+	e.u256(m.Target)
+	e.u16(m.ExtranonceSize)
+	if err := e.b032(m.ExtranoncePrefix); err != nil {
+		return nil, err
+	}
+	return e.buf, nil
+}
+
+type OpenMiningChannelError struct {
+	RequestID uint32
+	ErrorCode string
+}
+
+func (m *OpenMiningChannelError) encode() ([]byte, error) {
+	e := &encoder{}
+	e.u32(m.RequestID)
+	if err := e.str0255(m.ErrorCode); err != nil {
+		return nil, err
+	}
+	return e.buf, nil
+}
+
+// NewMiningJob is sent on standard channels; the pool keeps the coinbase and
+// only publishes the resulting merkle root.
+type NewMiningJob struct {
+	ChannelID uint32
+	JobID     uint32
+	MinNTime  *uint32
+	Version   uint32
+	// MerkleRoot is a B0_32 field on the wire, so it carries a length prefix
+	// unlike the U256 hashes elsewhere.
+	MerkleRoot []byte
+}
+
+func (m *NewMiningJob) encode() ([]byte, error) {
+	e := &encoder{}
+	e.u32(m.ChannelID)
+	e.u32(m.JobID)
+	e.optionU32(m.MinNTime)
+	e.u32(m.Version)
+	if err := e.b032(m.MerkleRoot); err != nil {
+		return nil, err
+	}
+	return e.buf, nil
+}
+
+// NewExtendedMiningJob carries the coinbase split around the extranonce, the
+// Stratum V2 counterpart of coinbase1/coinbase2 in mining.notify.
+type NewExtendedMiningJob struct {
+	ChannelID             uint32
+	JobID                 uint32
+	MinNTime              *uint32
+	Version               uint32
+	VersionRollingAllowed bool
+	MerklePath            [][32]byte
+	CoinbaseTxPrefix      []byte
+	CoinbaseTxSuffix      []byte
+}
+
+func (m *NewExtendedMiningJob) encode() ([]byte, error) {
+	e := &encoder{}
+	e.u32(m.ChannelID)
+	e.u32(m.JobID)
+	e.optionU32(m.MinNTime)
+	e.u32(m.Version)
+	e.bool(m.VersionRollingAllowed)
+	if err := e.seq0255u256(m.MerklePath); err != nil {
+		return nil, err
+	}
+	if err := e.b064k(m.CoinbaseTxPrefix); err != nil {
+		return nil, err
+	}
+	if err := e.b064k(m.CoinbaseTxSuffix); err != nil {
+		return nil, err
+	}
+	return e.buf, nil
+}
+
+type SetNewPrevHash struct {
+	ChannelID uint32
+	JobID     uint32
+	PrevHash  [32]byte
+	MinNTime  uint32
+	NBits     uint32
+}
+
+func (m *SetNewPrevHash) encode() ([]byte, error) {
+	e := &encoder{}
+	e.u32(m.ChannelID)
+	e.u32(m.JobID)
+	e.u256(m.PrevHash)
+	e.u32(m.MinNTime)
+	e.u32(m.NBits)
+	return e.buf, nil
+}
+
+// decodeMessage turns a frame into one of the message structs above. Frames
+// the client does not understand are returned as nil without error.
+func decodeMessage(f *Frame) (any, error) {
+	d := &decoder{buf: f.Payload}
+	var msg any
+	switch f.MsgType {
+	case MsgSetupConnection:
+		return decodeSetupConnection(f.Payload)
+	case MsgSetupConnectionSuccess:
+		msg = &SetupConnectionSuccess{UsedVersion: d.u16(), Flags: d.u32()}
+	case MsgSetupConnectionError:
+		msg = &SetupConnectionError{Flags: d.u32(), ErrorCode: d.str0255()}
+	case MsgOpenStandardMiningChannel:
+		msg = &OpenStandardMiningChannel{RequestID: d.u32(), UserIdentity: d.str0255(), NominalHashRate: d.f32(), MaxTarget: d.u256()}
+	case MsgOpenExtendedMiningChannel:
+		msg = &OpenExtendedMiningChannel{RequestID: d.u32(), UserIdentity: d.str0255(), NominalHashRate: d.f32(), MaxTarget: d.u256(), MinExtranonceLen: d.u16()}
+	case MsgOpenStandardMiningChannelSuccess:
+		msg = &OpenStandardMiningChannelSuccess{RequestID: d.u32(), ChannelID: d.u32(), Target: d.u256(), ExtranoncePrefix: d.b032(), GroupChannelID: d.u32()}
+	case MsgOpenExtendedMiningChannelSuccess:
+		msg = &OpenExtendedMiningChannelSuccess{RequestID: d.u32(), ChannelID: d.u32(), Target: d.u256(), ExtranonceSize: d.u16(), ExtranoncePrefix: d.b032()}
+	case MsgOpenMiningChannelError:
+		msg = &OpenMiningChannelError{RequestID: d.u32(), ErrorCode: d.str0255()}
+	case MsgNewMiningJob:
+		msg = &NewMiningJob{ChannelID: d.u32(), JobID: d.u32(), MinNTime: d.optionU32(), Version: d.u32(), MerkleRoot: d.b032()}
+	case MsgNewExtendedMiningJob:
+		msg = &NewExtendedMiningJob{
+			ChannelID:             d.u32(),
+			JobID:                 d.u32(),
+			MinNTime:              d.optionU32(),
+			Version:               d.u32(),
+			VersionRollingAllowed: d.bool(),
+			MerklePath:            d.seq0255u256(),
+			CoinbaseTxPrefix:      d.b064k(),
+			CoinbaseTxSuffix:      d.b064k(),
+		}
+	case MsgSetNewPrevHash:
+		msg = &SetNewPrevHash{ChannelID: d.u32(), JobID: d.u32(), PrevHash: d.u256(), MinNTime: d.u32(), NBits: d.u32()}
+	default:
+		return nil, nil
+	}
+	if d.err != nil {
+		return nil, fmt.Errorf("sv2: message 0x%02x: %w", f.MsgType, d.err)
+	}
+	return msg, nil
+}
+
+type encodable interface {
+	encode() ([]byte, error)
+}
+
+func messageType(msg encodable) (uint8, error) {
+	switch msg.(type) {
+	case *SetupConnection:
+		return MsgSetupConnection, nil
+	case *SetupConnectionSuccess:
+		return MsgSetupConnectionSuccess, nil
+	case *SetupConnectionError:
+		return MsgSetupConnectionError, nil
+	case *OpenStandardMiningChannel:
+		return MsgOpenStandardMiningChannel, nil
+	case *OpenStandardMiningChannelSuccess:
+		return MsgOpenStandardMiningChannelSuccess, nil
+	case *OpenExtendedMiningChannel:
+		return MsgOpenExtendedMiningChannel, nil
+	case *OpenExtendedMiningChannelSuccess:
+		return MsgOpenExtendedMiningChannelSuccess, nil
+	case *OpenMiningChannelError:
+		return MsgOpenMiningChannelError, nil
+	case *NewMiningJob:
+		return MsgNewMiningJob, nil
+	case *NewExtendedMiningJob:
+		return MsgNewExtendedMiningJob, nil
+	case *SetNewPrevHash:
+		return MsgSetNewPrevHash, nil
+	default:
+		return 0, fmt.Errorf("sv2: unsupported message %T", msg)
+	}
+}
@@ -0,0 +1,133 @@
+package sv2
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestMessageRoundTrip(t *testing.T) {
+	minNTime := uint32(1700000000)
+	var target, hash [32]byte
+	for i := range target {
+		target[i] = byte(i)
+		hash[i] = byte(0xff - i)
+	}
+	msgs := []encodable{
+		&SetupConnection{
+			MinVersion:      2,
+			MaxVersion:      2,
+			Flags:           FlagRequiresVersionRolling,
+			EndpointHost:    "pool.example",
+			EndpointPort:    3336,
+			Vendor:          "bitaxe",
+			HardwareVersion: "BM1370",
+			Firmware:        "v2.6.1",
+			DeviceID:        "unit-1",
+		},
+		&SetupConnectionSuccess{UsedVersion: 2, Flags: 4},
+		&SetupConnectionError{Flags: 1, ErrorCode: "unsupported-protocol"},
+		&OpenStandardMiningChannel{RequestID: 7, UserIdentity: "worker", NominalHashRate: 1e12, MaxTarget: target},
+		&OpenStandardMiningChannelSuccess{RequestID: 7, ChannelID: 3, Target: target, ExtranoncePrefix: []byte{1, 2, 3, 4}, GroupChannelID: 9},
+		&OpenExtendedMiningChannel{RequestID: 8, UserIdentity: "worker", NominalHashRate: 5e11, MaxTarget: target, MinExtranonceLen: 4},
+		&OpenExtendedMiningChannelSuccess{RequestID: 8, ChannelID: 4, Target: target, ExtranonceSize: 8, ExtranoncePrefix: []byte{5, 6}},
+		&OpenMiningChannelError{RequestID: 8, ErrorCode: "unsupported-extended-channel"},
+		&NewMiningJob{ChannelID: 3, JobID: 1, MinNTime: &minNTime, Version: 0x20000000, MerkleRoot: hash[:]},
+		&NewMiningJob{ChannelID: 3, JobID: 2, Version: 0x20000000, MerkleRoot: hash[:]},
+		&NewExtendedMiningJob{
+			ChannelID:             4,
+			JobID:                 1,
+			Version:               0x20000000,
+			VersionRollingAllowed: true,
+			MerklePath:            [][32]byte{hash, target},
+			CoinbaseTxPrefix:      []byte{0x01, 0x00, 0x00, 0x00},
+			CoinbaseTxSuffix:      []byte{0xff, 0xff, 0xff, 0xff},
+		},
+		&SetNewPrevHash{ChannelID: 4, JobID: 1, PrevHash: hash, MinNTime: minNTime, NBits: 0x1703255b},
+	}
+	for _, msg := range msgs {
+		msgType, err := messageType(msg)
+		if err != nil {
+			t.Fatalf("%T: %v", msg, err)
+		}
+		payload, err := msg.encode()
+		if err != nil {
+			t.Fatalf("%T: encode: %v", msg, err)
+		}
+		got, err := decodeMessage(&Frame{MsgType: msgType, Payload: payload})
+		if err != nil {
+			t.Fatalf("%T: decode: %v", msg, err)
+		}
+		if !reflect.DeepEqual(got, msg) {
+			t.Errorf("%T: round trip gave %+v, want %+v", msg, got, msg)
+		}
+	}
+}
+
+// TestNewMiningJobWireFormat decodes a NewMiningJob laid out by hand from the
+// spec: channel_id U32, job_id U32, min_ntime OPTION[U32], version U32 and
+// merkle_root B0_32, whose length byte a U256 would lack.
+func TestNewMiningJobWireFormat(t *testing.T) {
+	root := make([]byte, 32)
+	for i := range root {
+		root[i] = byte(0xa0 + i%16)
+	}
+	payload := []byte{
+		0x03, 0x00, 0x00, 0x00, // channel_id 3
+		0x01, 0x00, 0x00, 0x00, // job_id 1
+		0x01, 0x00, 0xf1, 0x53, 0x65, // min_ntime Some(1700000000)
+		0x00, 0x00, 0x00, 0x20, // version 0x20000000
+		0x20, // merkle_root length 32
+	}
+	payload = append(payload, root...)
+
+	msg, err := decodeMessage(&Frame{MsgType: MsgNewMiningJob, Payload: payload})
+	if err != nil {
+		t.Fatal(err)
+	}
+	minNTime := uint32(1700000000)
+	want := &NewMiningJob{ChannelID: 3, JobID: 1, MinNTime: &minNTime, Version: 0x20000000, MerkleRoot: root}
+	if !reflect.DeepEqual(msg, want) {
+		t.Fatalf("decoded %+v, want %+v", msg, want)
+	}
+	encoded, err := want.encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(encoded, payload) {
+		t.Errorf("encoded %x, want %x", encoded, payload)
+	}
+	if _, err := decodeMessage(&Frame{MsgType: MsgNewMiningJob, Payload: payload[:len(payload)-1]}); err == nil {
+		t.Error("merkle root shorter than its length prefix decoded without error")
+	}
+}
+
+func TestDecodeTruncatedMessage(t *testing.T) {
+	payload, err := (&SetNewPrevHash{ChannelID: 1, NBits: 0x1d00ffff}).encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := decodeMessage(&Frame{MsgType: MsgSetNewPrevHash, Payload: payload[:len(payload)-1]}); err == nil {
+		t.Fatal("truncated SetNewPrevHash decoded without error")
+	}
+}
+
+func TestDecodeUnknownMessage(t *testing.T) {
+	msg, err := decodeMessage(&Frame{MsgType: 0x7f, Payload: []byte{1, 2, 3}})
+	if err != nil || msg != nil {
+		t.Fatalf("unknown message: got %v, %v; want nil, nil", msg, err)
+	}
+}
+
+func TestEncodeRejectsOversizedFields(t *testing.T) {
+	long := make([]byte, 256)
+	for i := range long {
+		long[i] = 'a'
+	}
+	if _, err := (&SetupConnectionError{ErrorCode: string(long)}).encode(); err == nil {
+		t.Error("STR0_255 of 256 bytes encoded without error")
+	}
+	if _, err := (&OpenExtendedMiningChannelSuccess{ExtranoncePrefix: make([]byte, 33)}).encode(); err == nil {
+		t.Error("B0_32 of 33 bytes encoded without error")
+	}
+}
@@ -0,0 +1,365 @@
+package sv2
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/ellswift"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// protocolName identifies the Noise variant used by Stratum V2.
+const protocolName = "Noise_NX_Secp256k1+EllSwift_ChaChaPoly_SHA256"
+
+const (
+	ellswiftLen      = 64
+	macLen           = chacha20poly1305.Overhead
+	sigMessageLen    = 2 + 4 + 4 + 64
+	handshakeAct1Len = ellswiftLen
+	handshakeAct2Len = ellswiftLen + ellswiftLen + macLen + sigMessageLen + macLen
+)
+
+// Certificate is the SIGNATURE_NOISE_MESSAGE a pool sends during the
+// handshake, binding its static key to an authority key.
+type Certificate struct {
+	Version       uint16
+	ValidFrom     uint32
+	NotValidAfter uint32
+	Signature     [64]byte
+	// ServerKey is the x-only static key of the server.
+	ServerKey [32]byte
+	// Verified is set when the signature was checked against an authority key.
+	Verified bool
+}
+
+func (c *Certificate) encode() []byte {
+	e := &encoder{}
+	e.u16(c.Version)
+	e.u32(c.ValidFrom)
+	e.u32(c.NotValidAfter)
+	e.buf = append(e.buf, c.Signature[:]...)
+	return e.buf
+}
+
+func decodeCertificate(raw []byte) (*Certificate, error) {
+	d := &decoder{buf: raw}
+	c := &Certificate{Version: d.u16(), ValidFrom: d.u32(), NotValidAfter: d.u32()}
+	copy(c.Signature[:], d.take(64))
+	return c, d.err
+}
+
+// signedHash is the digest the authority key signs.
+func (c *Certificate) signedHash() []byte {
+	e := &encoder{}
+	e.u16(c.Version)
+	e.u32(c.ValidFrom)
+	e.u32(c.NotValidAfter)
+	e.buf = append(e.buf, c.ServerKey[:]...)
+	sum := sha256.Sum256(e.buf)
+	return sum[:]
+}
+
+func (c *Certificate) verify(authority *btcec.PublicKey, now time.Time) error {
+	sig, err := schnorr.ParseSignature(c.Signature[:])
+	if err != nil {
+		return fmt.Errorf("sv2: certificate signature: %w", err)
+	}
+	if !sig.Verify(c.signedHash(), authority) {
+		return errors.New("sv2: certificate not signed by authority")
+	}
+	ts := uint32(now.Unix())
+	if ts < c.ValidFrom || ts > c.NotValidAfter {
+		return fmt.Errorf("sv2: certificate valid %d..%d, now %d", c.ValidFrom, c.NotValidAfter, ts)
+	}
+	c.Verified = true
+	return nil
+}
+
+// cipherState is the Noise CipherState for ChaChaPoly.
+type cipherState struct {
+	key   [32]byte
+	hasK  bool
+	nonce uint64
+}
+
+func (cs *cipherState) initializeKey(k []byte) {
+	copy(cs.key[:], k)
+	cs.hasK = true
+	cs.nonce = 0
+}
+
+func (cs *cipherState) nonceBytes() []byte {
+	var n [chacha20poly1305.NonceSize]byte
+	binary.LittleEndian.PutUint64(n[4:], cs.nonce)
+	return n[:]
+}
+
+func (cs *cipherState) encrypt(ad, plaintext []byte) ([]byte, error) {
+	if !cs.hasK {
+		return append([]byte(nil), plaintext...), nil
+	}
+	aead, err := chacha20poly1305.New(cs.key[:])
+	if err != nil {
+		return nil, err
+	}
+	out := aead.Seal(nil, cs.nonceBytes(), plaintext, ad)
+	cs.nonce++
+	return out, nil
+}
+
+func (cs *cipherState) decrypt(ad, ciphertext []byte) ([]byte, error) {
+	if !cs.hasK {
+		return append([]byte(nil), ciphertext...), nil
+	}
+	aead, err := chacha20poly1305.New(cs.key[:])
+	if err != nil {
+		return nil, err
+	}
+	out, err := aead.Open(nil, cs.nonceBytes(), ciphertext, ad)
+	if err != nil {
+		return nil, fmt.Errorf("sv2: decrypt: %w", err)
+	}
+	cs.nonce++
+	return out, nil
+}
+
+// symmetricState is the Noise SymmetricState (ck, h and a cipher).
+type symmetricState struct {
+	cs cipherState
+	ck [32]byte
+	h  [32]byte
+}
+
+func newSymmetricState() *symmetricState {
+	ss := &symmetricState{}
+	ss.h = sha256.Sum256([]byte(protocolName))
+	ss.ck = ss.h
+	// Stratum V2 uses an empty prologue.
+	ss.mixHash(nil)
+	return ss
+}
+
+func (ss *symmetricState) mixHash(data []byte) {
+	h := sha256.New()
+	h.Write(ss.h[:])
+	h.Write(data)
+	copy(ss.h[:], h.Sum(nil))
+}
+
+func (ss *symmetricState) mixKey(ikm []byte) {
+	ck, k := hkdf2(ss.ck[:], ikm)
+	ss.ck = ck
+	ss.cs.initializeKey(k[:])
+}
+
+func (ss *symmetricState) encryptAndHash(plaintext []byte) ([]byte, error) {
+	out, err := ss.cs.encrypt(ss.h[:], plaintext)
+	if err != nil {
+		return nil, err
+	}
+	ss.mixHash(out)
+	return out, nil
+}
+
+func (ss *symmetricState) decryptAndHash(ciphertext []byte) ([]byte, error) {
+	out, err := ss.cs.decrypt(ss.h[:], ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	ss.mixHash(ciphertext)
+	return out, nil
+}
+
+// split returns the initiator-to-responder and responder-to-initiator ciphers.
+func (ss *symmetricState) split() (*cipherState, *cipherState) {
+	k1, k2 := hkdf2(ss.ck[:], nil)
+	c1, c2 := &cipherState{}, &cipherState{}
+	c1.initializeKey(k1[:])
+	c2.initializeKey(k2[:])
+	return c1, c2
+}
+
+func hkdf2(chainingKey, ikm []byte) ([32]byte, [32]byte) {
+	var out1, out2 [32]byte
+	tmp := hmacSHA256(chainingKey, ikm)
+	copy(out1[:], hmacSHA256(tmp, []byte{0x01}))
+	copy(out2[:], hmacSHA256(tmp, append(out1[:], 0x02)))
+	return out1, out2
+}
+
+func hmacSHA256(key, data []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+func ecdh(priv *btcec.PrivateKey, theirs, ours [64]byte, initiating bool) ([]byte, error) {
+	secret, err := ellswift.V2Ecdh(priv, theirs, ours, initiating)
+	if err != nil {
+		return nil, fmt.Errorf("sv2: ecdh: %w", err)
+	}
+	return secret[:], nil
+}
+
+// xOnlyFromEllswift decodes an ElligatorSwift public key to its x coordinate.
+func xOnlyFromEllswift(enc [64]byte) ([32]byte, error) {
+	var u, t btcec.FieldVal
+	u.SetByteSlice(enc[:32])
+	t.SetByteSlice(enc[32:])
+	x, err := ellswift.XSwiftEC(&u, &t)
+	if err != nil {
+		return [32]byte{}, err
+	}
+	return *x.Bytes(), nil
+}
+
+// initiatorHandshake runs the client side of Noise NX over rw. When authority
+// is nil the certificate is decoded but not verified.
+func initiatorHandshake(rw io.ReadWriter, authority *btcec.PublicKey, now time.Time) (send, recv *cipherState, cert *Certificate, err error) {
+	ss := newSymmetricState()
+
+	// -> e
+	ePriv, ePub, err := ellswift.EllswiftCreate()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	ss.mixHash(ePub[:])
+	if _, err := ss.encryptAndHash(nil); err != nil {
+		return nil, nil, nil, err
+	}
+	if _, err := rw.Write(ePub[:]); err != nil {
+		return nil, nil, nil, err
+	}
+
+	// <- e, ee, s, es, SIGNATURE_NOISE_MESSAGE
+	act2 := make([]byte, handshakeAct2Len)
+	if _, err := io.ReadFull(rw, act2); err != nil {
+		return nil, nil, nil, fmt.Errorf("sv2: handshake: %w", err)
+	}
+	var re [64]byte
+	copy(re[:], act2[:ellswiftLen])
+	ss.mixHash(re[:])
+	secret, err := ecdh(ePriv, re, ePub, true)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	ss.mixKey(secret)
+
+	sEnc := act2[ellswiftLen : ellswiftLen+ellswiftLen+macLen]
+	sRaw, err := ss.decryptAndHash(sEnc)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	var rs [64]byte
+	copy(rs[:], sRaw)
+	secret, err = ecdh(ePriv, rs, ePub, true)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	ss.mixKey(secret)
+
+	sigRaw, err := ss.decryptAndHash(act2[ellswiftLen+ellswiftLen+macLen:])
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	cert, err = decodeCertificate(sigRaw)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if cert.ServerKey, err = xOnlyFromEllswift(rs); err != nil {
+		return nil, nil, nil, err
+	}
+	if authority != nil {
+		if err := cert.verify(authority, now); err != nil {
+			return nil, nil, cert, err
+		}
+	}
+
+	c1, c2 := ss.split()
+	return c1, c2, cert, nil
+}
+
+// ResponderKeys holds the static identity a Stratum V2 server presents.
+type ResponderKeys struct {
+	Static      *btcec.PrivateKey
+	StaticPub   [64]byte
+	Certificate Certificate
+}
+
+// NewResponderKeys creates a static key and a certificate for it signed by
+// authority, valid for the given window.
+func NewResponderKeys(authority *btcec.PrivateKey, validFrom, notValidAfter time.Time) (*ResponderKeys, error) {
+	static, staticPub, err := ellswift.EllswiftCreate()
+	if err != nil {
+		return nil, err
+	}
+	keys := &ResponderKeys{Static: static, StaticPub: staticPub}
+	keys.Certificate = Certificate{
+		Version:       0,
+		ValidFrom:     uint32(validFrom.Unix()),
+		NotValidAfter: uint32(notValidAfter.Unix()),
+	}
+	copy(keys.Certificate.ServerKey[:], schnorr.SerializePubKey(static.PubKey()))
+	sig, err := schnorr.Sign(authority, keys.Certificate.signedHash())
+	if err != nil {
+		return nil, err
+	}
+	copy(keys.Certificate.Signature[:], sig.Serialize())
+	return keys, nil
+}
+
+// responderHandshake runs the server side of Noise NX over rw.
+func responderHandshake(rw io.ReadWriter, keys *ResponderKeys) (send, recv *cipherState, err error) {
+	ss := newSymmetricState()
+
+	// -> e
+	var re [64]byte
+	if _, err := io.ReadFull(rw, re[:]); err != nil {
+		return nil, nil, fmt.Errorf("sv2: handshake: %w", err)
+	}
+	ss.mixHash(re[:])
+	if _, err := ss.decryptAndHash(nil); err != nil {
+		return nil, nil, err
+	}
+
+	// <- e, ee, s, es, SIGNATURE_NOISE_MESSAGE
+	ePriv, ePub, err := ellswift.EllswiftCreate()
+	if err != nil {
+		return nil, nil, err
+	}
+	out := append([]byte(nil), ePub[:]...)
+	ss.mixHash(ePub[:])
+	secret, err := ecdh(ePriv, re, ePub, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	ss.mixKey(secret)
+	sEnc, err := ss.encryptAndHash(keys.StaticPub[:])
+	if err != nil {
+		return nil, nil, err
+	}
+	out = append(out, sEnc...)
+	secret, err = ecdh(keys.Static, re, keys.StaticPub, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	ss.mixKey(secret)
+	sigEnc, err := ss.encryptAndHash(keys.Certificate.encode())
+	if err != nil {
+		return nil, nil, err
+	}
+	out = append(out, sigEnc...)
+	if _, err := rw.Write(out); err != nil {
+		return nil, nil, err
+	}
+
+	c1, c2 := ss.split()
+	return c2, c1, nil
+}
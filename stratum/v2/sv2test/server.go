@@ -0,0 +1,246 @@
+// Package sv2test provides an in-process Stratum V2 pool for tests.
+package sv2test
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+
+	sv2 "poolcensus/desktop/stratum/v2"
+)
+
+// Config controls what the server hands out to every connection.
+type Config struct {
+	CoinbasePrefix   []byte
+	CoinbaseSuffix   []byte
+	ExtranoncePrefix []byte
+	ExtranonceSize   uint16
+	MerklePath       [][32]byte
+	Version          uint32
+	PrevHash         [32]byte
+	NBits            uint32
+	MerkleRoot       [32]byte
+	// RejectExtended answers OpenExtendedMiningChannel with an error, like
+	// pools that only serve standard channels.
+	RejectExtended bool
+	// SetupError, when non-empty, rejects SetupConnection with this code.
+	SetupError string
+}
+
+// Server is a minimal Stratum V2 mining server listening on localhost.
+type Server struct {
+	cfg       Config
+	authority *btcec.PrivateKey
+	keys      *sv2.ResponderKeys
+	ln        net.Listener
+
+	mu     sync.Mutex
+	conns  []net.Conn
+	wg     sync.WaitGroup
+	setups []*sv2.SetupConnection
+	users  []string
+}
+
+// NewServer starts a server with a fresh authority key and certificate.
+func NewServer(cfg Config) (*Server, error) {
+	authority, err := btcec.NewPrivateKey()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	keys, err := sv2.NewResponderKeys(authority, now.Add(-time.Hour), now.Add(time.Hour))
+	if err != nil {
+		return nil, err
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{cfg: cfg, authority: authority, keys: keys, ln: ln}
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+// AuthorityKey returns the base58check authority key clients should pin.
+func (s *Server) AuthorityKey() string {
+	return sv2.EncodeAuthorityKey(s.authority.PubKey())
+}
+
+// Authority returns the authority public key.
+func (s *Server) Authority() *btcec.PublicKey {
+	return s.authority.PubKey()
+}
+
+// Setups returns every SetupConnection received so far.
+func (s *Server) Setups() []*sv2.SetupConnection {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*sv2.SetupConnection(nil), s.setups...)
+}
+
+// Users returns the user identity of every channel opened so far.
+func (s *Server) Users() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.users...)
+}
+
+func (s *Server) Host() string {
+	host, _, _ := net.SplitHostPort(s.ln.Addr().String())
+	return host
+}
+
+func (s *Server) Port() int {
+	_, port, _ := net.SplitHostPort(s.ln.Addr().String())
+	p, _ := strconv.Atoi(port)
+	return p
+}
+
+func (s *Server) Close() {
+	_ = s.ln.Close()
+	s.mu.Lock()
+	for _, c := range s.conns {
+		_ = c.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		raw, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.conns = append(s.conns, raw)
+		s.mu.Unlock()
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer raw.Close()
+			_ = s.handle(raw)
+		}()
+	}
+}
+
+func (s *Server) handle(raw net.Conn) error {
+	conn, err := sv2.ServerHandshake(raw, s.keys)
+	if err != nil {
+		return err
+	}
+	var nextChannel uint32
+	for {
+		msg, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+		switch m := msg.(type) {
+		case *sv2.SetupConnection:
+			s.mu.Lock()
+			s.setups = append(s.setups, m)
+			s.mu.Unlock()
+			if s.cfg.SetupError != "" {
+				if err := conn.WriteMessage(&sv2.SetupConnectionError{ErrorCode: s.cfg.SetupError}); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := conn.WriteMessage(&sv2.SetupConnectionSuccess{UsedVersion: m.MaxVersion}); err != nil {
+				return err
+			}
+		case *sv2.OpenExtendedMiningChannel:
+			if s.cfg.RejectExtended {
+				if err := conn.WriteMessage(&sv2.OpenMiningChannelError{RequestID: m.RequestID, ErrorCode: "unsupported-extended-channel"}); err != nil {
+					return err
+				}
+				continue
+			}
+			nextChannel++
+			s.recordUser(m.UserIdentity)
+			if err := s.openExtended(conn, m, nextChannel); err != nil {
+				return err
+			}
+		case *sv2.OpenStandardMiningChannel:
+			nextChannel++
+			s.recordUser(m.UserIdentity)
+			if err := s.openStandard(conn, m, nextChannel); err != nil {
+				return err
+			}
+		case *sv2.Frame:
+			// Unknown messages are ignored, as a real pool would.
+		default:
+			return errors.New("sv2test: unexpected message")
+		}
+	}
+}
+
+func (s *Server) recordUser(user string) {
+	s.mu.Lock()
+	s.users = append(s.users, user)
+	s.mu.Unlock()
+}
+
+func (s *Server) openExtended(conn *sv2.Conn, m *sv2.OpenExtendedMiningChannel, channelID uint32) error {
+	size := s.cfg.ExtranonceSize
+	if size < m.MinExtranonceLen {
+		size = m.MinExtranonceLen
+	}
+	if err := conn.WriteMessage(&sv2.OpenExtendedMiningChannelSuccess{
+		RequestID:        m.RequestID,
+		ChannelID:        channelID,
+		Target:           m.MaxTarget,
+		ExtranonceSize:   size,
+		ExtranoncePrefix: s.cfg.ExtranoncePrefix,
+	}); err != nil {
+		return err
+	}
+	if err := conn.WriteMessage(&sv2.NewExtendedMiningJob{
+		ChannelID:             channelID,
+		JobID:                 1,
+		Version:               s.cfg.Version,
+		VersionRollingAllowed: true,
+		MerklePath:            s.cfg.MerklePath,
+		CoinbaseTxPrefix:      s.cfg.CoinbasePrefix,
+		CoinbaseTxSuffix:      s.cfg.CoinbaseSuffix,
+	}); err != nil {
+		return err
+	}
+	return s.sendPrevHash(conn, channelID)
+}
+
+func (s *Server) openStandard(conn *sv2.Conn, m *sv2.OpenStandardMiningChannel, channelID uint32) error {
+	if err := conn.WriteMessage(&sv2.OpenStandardMiningChannelSuccess{
+		RequestID:        m.RequestID,
+		ChannelID:        channelID,
+		Target:           m.MaxTarget,
+		ExtranoncePrefix: s.cfg.ExtranoncePrefix,
+	}); err != nil {
+		return err
+	}
+	if err := conn.WriteMessage(&sv2.NewMiningJob{
+		ChannelID:  channelID,
+		JobID:      1,
+		Version:    s.cfg.Version,
+		MerkleRoot: s.cfg.MerkleRoot[:],
+	}); err != nil {
+		return err
+	}
+	return s.sendPrevHash(conn, channelID)
+}
+
+func (s *Server) sendPrevHash(conn *sv2.Conn, channelID uint32) error {
+	return conn.WriteMessage(&sv2.SetNewPrevHash{
+		ChannelID: channelID,
+		JobID:     1,
+		PrevHash:  s.cfg.PrevHash,
+		MinNTime:  uint32(time.Now().Unix()),
+		NBits:     s.cfg.NBits,
+	})
+}
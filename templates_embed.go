@@ -3,6 +3,7 @@ package main
 import (
 	"embed"
 	"html/template"
+	"strings"
 )
 
 //go:embed templates/*.tmpl
@@ -18,7 +19,9 @@ func loadTemplates() (*template.Template, error) {
 		"fmtPct": func(f float64) string {
 			return formatTrimmedFloat(f, 2) + "%"
 		},
-		"blockchainAddressURL": blockchainAddressURL,
+		"btc":                formatBTC,
+		"explorerAddressURL": explorerAddressURL,
+		"join":               strings.Join,
 	}
 
 	t := template.New("poolcensus").Funcs(funcMap)
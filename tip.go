@@ -0,0 +1,155 @@
+package main
+
+import (
+	"sort"
+	"time"
+)
+
+// minTipVoters is how many pools on a network must report a height before
+// the majority is trusted as the chain tip.
+const minTipVoters = 3
+
+// tipCheck compares one pool's job with the chain tip the majority of pools
+// were working on at scan time.
+type tipCheck struct {
+	Height      uint32
+	PrevHash    string
+	TipHeight   uint32
+	TipPrevHash string
+	Votes       int
+	Voters      int
+	// Behind is how many blocks the pool's job trails the tip.
+	Behind int
+	// MinorityPrev is set when the pool is at the tip height but builds on a
+	// different previous block than the majority there.
+	MinorityPrev bool
+	// Bits and TipBits are the pool's nbits and the majority's on the tip
+	// block. BitsMismatch is set when a pool building on that block uses
+	// other nbits; the chain fixes them, so only one value is valid.
+	Bits         string
+	TipBits      string
+	BitsMismatch bool
+}
+
+// Stale reports whether the pool was handed work that cannot extend the tip.
+func (c *tipCheck) Stale() bool {
+	return c.Behind > 0 || c.MinorityPrev
+}
+
+// checkTips works out each network's chain tip by majority vote of the
+// aggregates' block heights, then of prevhashes at that height, and records
+// how every pool's job compares. A network's tip is only trusted when more
+// than half of its pools agree on the height. The nbits of pools building on
+// the tip block are compared the same way, except on networks whose
+// difficulty may drop to the minimum for a late block.
+func checkTips(aggregates []*scanAggregate) {
+	byNetwork := make(map[string][]*scanAggregate)
+	for _, agg := range aggregates {
+		entry := agg.latest
+		if entry == nil || !entry.Connected || entry.BlockHeight == 0 {
+			continue
+		}
+		network := firstNonEmpty(entry.Network, networkMainnet)
+		byNetwork[network] = append(byNetwork[network], agg)
+	}
+
+	for network, aggs := range byNetwork {
+		if len(aggs) < minTipVoters {
+			continue
+		}
+		heights := make(map[uint32]int)
+		for _, agg := range aggs {
+			heights[agg.latest.BlockHeight]++
+		}
+		tipHeight, votes := majority(heights)
+		if votes*2 <= len(aggs) {
+			continue
+		}
+
+		prevs := make(map[string]int)
+		withPrev := 0
+		var firstSeen time.Time
+		for _, agg := range aggs {
+			entry := agg.latest
+			if entry.BlockHeight != tipHeight {
+				continue
+			}
+			if entry.PrevHash != "" {
+				prevs[entry.PrevHash]++
+				withPrev++
+			}
+			if ts, ok := entryTime(entry); ok && (firstSeen.IsZero() || ts.Before(firstSeen)) {
+				firstSeen = ts
+			}
+		}
+		tipPrev, prevVotes := majority(prevs)
+		if prevVotes*2 <= withPrev {
+			tipPrev = ""
+		}
+
+		tipBits := ""
+		if tipPrev != "" && !networkParams(network).ReduceMinDifficulty {
+			bits := make(map[string]int)
+			withBits := 0
+			for _, agg := range aggs {
+				entry := agg.latest
+				if entry.BlockHeight == tipHeight && entry.PrevHash == tipPrev && entry.NBits != "" {
+					bits[entry.NBits]++
+					withBits++
+				}
+			}
+			if value, bitsVotes := majority(bits); bitsVotes*2 > withBits {
+				tipBits = value
+			}
+		}
+
+		for _, agg := range aggs {
+			entry := agg.latest
+			check := &tipCheck{
+				Height:      entry.BlockHeight,
+				PrevHash:    entry.PrevHash,
+				TipHeight:   tipHeight,
+				TipPrevHash: tipPrev,
+				Votes:       votes,
+				Voters:      len(aggs),
+				Bits:        entry.NBits,
+				TipBits:     tipBits,
+			}
+			switch {
+			case entry.BlockHeight < tipHeight:
+				// A job taken before any pool was seen on the tip may simply
+				// predate the block.
+				if ts, ok := entryTime(entry); !ok || firstSeen.IsZero() || !ts.Before(firstSeen) {
+					check.Behind = int(tipHeight - entry.BlockHeight)
+				}
+			case entry.BlockHeight == tipHeight:
+				check.MinorityPrev = tipPrev != "" && entry.PrevHash != "" && entry.PrevHash != tipPrev
+				check.BitsMismatch = tipBits != "" && entry.PrevHash == tipPrev && entry.NBits != "" && entry.NBits != tipBits
+			}
+			agg.tipCheck = check
+		}
+	}
+}
+
+// majority returns the most common key and its count; ties go to the
+// greatest key so a freshly found block wins over the one before it.
+func majority[K uint32 | string](counts map[K]int) (K, int) {
+	keys := make([]K, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] > keys[j] })
+	var best K
+	bestCount := 0
+	for _, k := range keys {
+		if counts[k] > bestCount {
+			best, bestCount = k, counts[k]
+		}
+	}
+	return best, bestCount
+}
+
+func entryTime(entry *logEntry) (time.Time, bool) {
+	ts, err := time.Parse(time.RFC3339, entry.Timestamp)
+	return ts, err == nil
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckTips(t *testing.T) {
+	tip := strings.Repeat("ab", 32)
+	rival := strings.Repeat("cd", 32)
+	older := strings.Repeat("ef", 32)
+	scanned := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	// pool describes one aggregate's latest job; the last pool is the one
+	// whose check is asserted.
+	type pool struct {
+		height uint32
+		prev   string
+		bits   string
+		at     time.Duration
+	}
+	onTip := pool{nodeTestHeight, tip, nodeTestBits, 0}
+	tests := []struct {
+		name    string
+		network string
+		pools   []pool
+		want    *tipCheck
+	}{
+		{"majority tip", networkMainnet, []pool{onTip, onTip, onTip}, &tipCheck{Votes: 3, Voters: 3}},
+		{"behind", networkMainnet, []pool{onTip, onTip, {nodeTestHeight - 1, older, nodeTestBits, time.Minute}}, &tipCheck{Votes: 2, Voters: 3, Behind: 1}},
+		// A job taken before any pool was seen on the tip may predate it.
+		{"behind before the tip was seen", networkMainnet, []pool{{nodeTestHeight, tip, nodeTestBits, time.Minute}, onTip, {nodeTestHeight - 1, older, nodeTestBits, -time.Minute}}, &tipCheck{Votes: 2, Voters: 3}},
+		{"minority prevhash", networkMainnet, []pool{onTip, onTip, {nodeTestHeight, rival, nodeTestBits, 0}}, &tipCheck{Votes: 3, Voters: 3, MinorityPrev: true}},
+		{"other bits", networkMainnet, []pool{onTip, onTip, {nodeTestHeight, tip, "1d00ffff", 0}}, &tipCheck{Votes: 3, Voters: 3, BitsMismatch: true}},
+		{"other bits on a competing block", networkMainnet, []pool{onTip, onTip, {nodeTestHeight, rival, "1d00ffff", 0}}, &tipCheck{Votes: 3, Voters: 3, MinorityPrev: true}},
+		// Testnet drops to the minimum difficulty for late blocks, so pools
+		// on the same tip may legitimately disagree.
+		{"reduce min difficulty", "testnet4", []pool{onTip, onTip, {nodeTestHeight, tip, "1d00ffff", 0}}, &tipCheck{Votes: 3, Voters: 3}},
+		{"too few voters", networkMainnet, []pool{onTip, {nodeTestHeight - 1, older, nodeTestBits, 0}}, nil},
+		{"no majority height", networkMainnet, []pool{onTip, onTip, {nodeTestHeight - 1, older, nodeTestBits, 0}, {nodeTestHeight - 1, older, nodeTestBits, 0}}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var aggs []*scanAggregate
+			for _, p := range tt.pools {
+				aggs = append(aggs, &scanAggregate{latest: &logEntry{
+					Timestamp:   scanned.Add(p.at).Format(time.RFC3339),
+					Connected:   true,
+					Network:     tt.network,
+					BlockHeight: p.height,
+					PrevHash:    p.prev,
+					NBits:       p.bits,
+				}})
+			}
+			checkTips(aggs)
+
+			last := aggs[len(aggs)-1]
+			check := last.tipCheck
+			if tt.want == nil {
+				if check != nil {
+					t.Fatalf("tip check %+v for an untrusted tip", check)
+				}
+				return
+			}
+			if check == nil {
+				t.Fatal("no tip check")
+			}
+			got := tipCheck{Votes: check.Votes, Voters: check.Voters, Behind: check.Behind, MinorityPrev: check.MinorityPrev, BitsMismatch: check.BitsMismatch}
+			if got != *tt.want {
+				t.Errorf("check %+v, want %+v", got, *tt.want)
+			}
+			if check.TipHeight != nodeTestHeight || check.TipPrevHash != tip {
+				t.Errorf("tip %d/%s, want %d/%s", check.TipHeight, check.TipPrevHash, nodeTestHeight, tip)
+			}
+
+			view := buildEntryView(last.latest, pingStats{}, pingStats{}, pingStats{}, nil, 0, 0, 0)
+			addTipIssues(view, check)
+			var stale, bits bool
+			for _, issue := range view.Issues {
+				stale = stale || issue.Score == severityStaleTip
+				bits = bits || strings.Contains(issue.Message, "used by most pools on the tip")
+			}
+			if stale != check.Stale() || bits != check.BitsMismatch {
+				t.Errorf("issues %+v for check %+v", view.Issues, check)
+			}
+		})
+	}
+}
@@ -1,29 +1,65 @@
 package main
 
-import "time"
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"poolcensus/desktop/stratum"
+)
 
 type logEntry struct {
-	Timestamp       string        `json:"timestamp"`
-	Host            string        `json:"host"`
-	Port            int           `json:"port"`
-	Connected       bool          `json:"connected"`
-	Error           string        `json:"error"`
-	UserAgent       string        `json:"user_agent"`
-	Username        string        `json:"username"`
-	TotalPayout     float64       `json:"total_payout"`
-	PingMs          float64       `json:"ping_ms"`
-	JobLatencyMs    float64       `json:"job_latency_ms,omitempty"`
-	WalletAddress   string        `json:"wallet_address"`
-	WorkerName      string        `json:"worker_name"`
-	Password        string        `json:"password"`
-	ExtraNonce1     string        `json:"extranonce1"`
-	ExtraNonce2Size int           `json:"extranonce2_size"`
-	Difficulty      float64       `json:"difficulty"`
-	BlockHeight     uint32        `json:"block_height"`
-	PoolTag         string        `json:"pool_tag"`
-	TLS             bool          `json:"tls"`
-	CoinbaseRaw     *coinbaseData `json:"coinbase_raw"`
-	Payouts         []payout      `json:"payouts"`
+	Timestamp       string              `json:"timestamp"`
+	Host            string              `json:"host"`
+	Port            int                 `json:"port"`
+	Connected       bool                `json:"connected"`
+	Error           string              `json:"error"`
+	UserAgent       string              `json:"user_agent"`
+	Username        string              `json:"username"`
+	TotalPayout     int64               `json:"total_payout_sat"`
+	PingMs          float64             `json:"ping_ms"`
+	JobLatencyMs    float64             `json:"job_latency_ms,omitempty"`
+	WalletAddress   string              `json:"wallet_address"`
+	WorkerName      string              `json:"worker_name"`
+	Password        string              `json:"password"`
+	ExtraNonce1     string              `json:"extranonce1"`
+	ExtraNonce2Size int                 `json:"extranonce2_size"`
+	Difficulty      float64             `json:"difficulty"`
+	BlockHeight     uint32              `json:"block_height"`
+	PrevHash        string              `json:"prev_hash,omitempty"`
+	NBits           string              `json:"nbits,omitempty"`
+	NTime           string              `json:"ntime,omitempty"`
+	Header          *headerData         `json:"header,omitempty"`
+	Commitments     []commitmentData    `json:"commitments,omitempty"`
+	Lint            []lintFinding       `json:"lint,omitempty"`
+	PoolTag         string              `json:"pool_tag"`
+	TLS             bool                `json:"tls"`
+	CoinbaseRaw     *coinbaseData       `json:"coinbase_raw"`
+	Payouts         []payout            `json:"payouts"`
+	ServerMessages  []string            `json:"server_messages,omitempty"`
+	Deviations      []protocolDeviation `json:"protocol_deviations,omitempty"`
+	Protocol        string              `json:"protocol,omitempty"`
+	SV2             *sv2Session         `json:"sv2,omitempty"`
+	Transcript      []transcriptLine    `json:"transcript,omitempty"`
+	Abuse           string              `json:"abuse,omitempty"`
+	Network         string              `json:"network,omitempty"`
+	ScriptSig       *scriptSigData      `json:"script_sig,omitempty"`
+}
+
+type transcriptLine struct {
+	OffsetMs  float64 `json:"offset_ms"`
+	Direction string  `json:"direction"`
+	Line      string  `json:"line"`
+}
+
+type sv2Session struct {
+	Channel             string `json:"channel"`
+	ServerKey           string `json:"server_key"`
+	CertificateVerified bool   `json:"certificate_verified"`
+	CertificateExpires  string `json:"certificate_expires,omitempty"`
+	MerkleRoot          string `json:"merkle_root,omitempty"`
+	PrevHash            string `json:"prev_hash,omitempty"`
+	Version             uint32 `json:"version"`
 }
 
 type coinbaseData struct {
@@ -32,11 +68,96 @@ type coinbaseData struct {
 	FullHex   string `json:"full_hex"`
 }
 
+type lintFinding struct {
+	Rule     string `json:"rule"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+// commitmentData is an OP_RETURN payload or scriptSig merged-mining root.
+type commitmentData struct {
+	Protocol     string `json:"protocol"`
+	Name         string `json:"name"`
+	Source       string `json:"source"`
+	OutputIndex  int    `json:"output_index"`
+	Hex          string `json:"hex"`
+	Payload      string `json:"payload,omitempty"`
+	Text         string `json:"text,omitempty"`
+	MergedMining bool   `json:"merged_mining,omitempty"`
+}
+
+// headerData is the block header rebuilt from a job and what is wrong with it.
+type headerData struct {
+	Version      string          `json:"version,omitempty"`
+	NBits        string          `json:"nbits,omitempty"`
+	NTime        string          `json:"ntime,omitempty"`
+	MerkleBranch []string        `json:"merkle_branch,omitempty"`
+	MerkleRoot   string          `json:"merkle_root,omitempty"`
+	Hex          string          `json:"hex,omitempty"`
+	Findings     []headerFinding `json:"findings,omitempty"`
+}
+
+type headerFinding struct {
+	Kind    string `json:"kind"`
+	Message string `json:"message"`
+}
+
+type scriptSigData struct {
+	Length      int             `json:"length"`
+	Height      uint32          `json:"height,omitempty"`
+	HasHeight   bool            `json:"has_height"`
+	Prefix      string          `json:"prefix"`
+	ExtraNonce1 string          `json:"extranonce1"`
+	ExtraNonce2 string          `json:"extranonce2"`
+	Suffix      string          `json:"suffix"`
+	Pushes      []scriptSigPush `json:"pushes,omitempty"`
+	Tags        []scriptSigTag  `json:"tags,omitempty"`
+	Violations  []string        `json:"violations,omitempty"`
+}
+
+type scriptSigPush struct {
+	Offset int    `json:"offset"`
+	Opcode string `json:"opcode"`
+	Data   string `json:"data,omitempty"`
+	Text   string `json:"text,omitempty"`
+	Role   string `json:"role"`
+}
+
+type scriptSigTag struct {
+	Source string `json:"source"`
+	Field  string `json:"field,omitempty"`
+	Text   string `json:"text"`
+}
+
 type payout struct {
-	OutputIndex int     `json:"output_index"`
-	Address     string  `json:"address"`
-	Amount      float64 `json:"amount_btc"`
-	Type        string  `json:"type"`
+	OutputIndex  int      `json:"output_index"`
+	Address      string   `json:"address"`
+	Amount       int64    `json:"amount_sat"`
+	Type         string   `json:"type"`
+	Script       string   `json:"script,omitempty"`
+	PubKeys      []string `json:"pubkeys,omitempty"`
+	RequiredSigs int      `json:"required_sigs,omitempty"`
+	Asm          string   `json:"asm,omitempty"`
+	Unspendable  bool     `json:"unspendable,omitempty"`
+}
+
+// Target is what the output pays: its address or, for outputs without one,
+// its keys or disassembled script.
+func (p payout) Target() string {
+	switch {
+	case p.Address != "":
+		return p.Address
+	case p.Type == stratum.ScriptMultisig:
+		return fmt.Sprintf("%d-of-%d multisig %s", p.RequiredSigs, len(p.PubKeys), strings.Join(p.PubKeys, " "))
+	case p.Type == stratum.ScriptP2PK && len(p.PubKeys) == 1:
+		return "pubkey " + p.PubKeys[0]
+	}
+	return p.Asm
+}
+
+type protocolDeviation struct {
+	Kind   string `json:"kind"`
+	Detail string `json:"detail"`
 }
 
 type issueDetail struct {
@@ -48,7 +169,7 @@ type issueDetail struct {
 type payoutView struct {
 	payout
 	IsWorker bool
-	Percent  float64
+	Percent  percentage
 }
 
 type pingSummary struct {
@@ -84,14 +205,19 @@ type entryView struct {
 	PingSummaryPrimary pingSummary
 	PingSummaryTLS     pingSummary
 	PingSort           float64
-	TotalPayout        float64
-	WorkerShare        float64
-	WorkerPercent      float64
+	TotalPayout        int64
+	Subsidy            int64
+	Fees               int64
+	HasSubsidy         bool
+	WorkerShare        int64
+	WorkerPercent      percentage
 	PoolWallet         string
 	PoolWalletDisp     string
 	PoolWalletURL      string
 	HasPoolWallet      bool
 	TLS                bool
+	Protocol           string
+	Network            string
 	ShowTLSPanel       bool
 	Issues             []issueDetail
 	IssueSeverity      int
@@ -113,11 +239,48 @@ type entryView struct {
 	JobLatencyClass    string
 	JobWaitSummary     jobSummary
 	JobWaitSort        float64
+	Conformance        conformanceSummary
+	Profiles           *profileComparison
+	AddressChecks      []addressCheck
+	SafetyChecks       []safetyCheck
+	FeeRank            *feeRank
+	TipCheck           *tipCheck
+	NodeCheck          *nodeCheck
+	Signals            *versionSignals
+	MergedMining       []string
+}
+
+type conformanceSummary struct {
+	Score      int
+	Class      string
+	Deviations int
+	Kinds      []string
+}
+
+type profileView struct {
+	Profile       string
+	Agent         string
+	Worker        string
+	AddressType   string
+	Wallet        string
+	Connected     bool
+	Error         string
+	HasData       bool
+	Outputs       int
+	WorkerPercent percentage
+	Layout        string
+}
+
+type profileComparison struct {
+	Views   []profileView
+	Differs bool
+	Reasons []string
 }
 
 type hostView struct {
 	Host   string
 	Latest *entryView
+	Raw    *logEntry
 }
 
 type hostEntry struct {
@@ -172,11 +335,35 @@ type changeDetail struct {
 	ScanURL string
 }
 
+type detailsView struct {
+	PoolName       string
+	Host           string
+	Timestamp      string
+	TimestampLocal string
+	BackURL        string
+	HistoryURL     string
+	JobLatency     string
+	Entry          *entryView
+	Raw            *logEntry
+}
+
 type dashboardView struct {
 	CleanEntries []*hostEntry
 	IssueEntries []*hostEntry
 	SortBy       string
 	HostFilter   string
+	Seed         int64
+	// NodeNetwork and NodeHeight describe the local node pools were compared
+	// with; NodeHeight is zero without -node-rpc.
+	NodeNetwork string
+	NodeHeight  uint32
+	Signalling  []signallingRow
+	// MergedMining lists, per merged-mining protocol, the pools committing
+	// to it.
+	MergedMining []mergedMiningRow
 }
 
-const defaultBaseReward = 3.125
+type mergedMiningRow struct {
+	Protocol string
+	Pools    []string
+}